@@ -0,0 +1,62 @@
+package goid
+
+import "sync/atomic"
+
+// DefaultActivityBufferSize is the default number of entries of the activity
+// ring buffer, see RecordActivity
+const DefaultActivityBufferSize = 256
+
+// activityRing is a fixed-size, lock-free ring buffer of goroutine ids
+type activityRing struct {
+	next  uint64  // Total number of ids ever recorded
+	slots []int64 // Recorded ids, 0 for empty slots
+}
+
+// activity holds the current *activityRing
+var activity atomic.Value
+
+func init() {
+	activity.Store(&activityRing{slots: make([]int64, DefaultActivityBufferSize)})
+}
+
+// SetActivityBufferSize replaces the activity ring buffer with an empty one of
+// size entries. Panics unless size is positive.
+func SetActivityBufferSize(size int) {
+	if size <= 0 {
+		panic("goid: invalid activity buffer size")
+	}
+	activity.Store(&activityRing{slots: make([]int64, size)})
+}
+
+// RecordActivity pushes the current goroutine id into a lock-free ring
+// buffer. It is cheap enough for hot paths, so that a monitor can periodically
+// inspect which goroutines are active via ActiveSample, without full stack
+// dumps.
+func RecordActivity() {
+	r := activity.Load().(*activityRing)
+	i := atomic.AddUint64(&r.next, 1) - 1
+	atomic.StoreInt64(&r.slots[i%uint64(len(r.slots))], int64(GetGoID()))
+}
+
+// ActiveSample returns the distinct goroutine ids currently in the activity
+// ring buffer, most recently recorded first
+func ActiveSample() []GoID {
+	r := activity.Load().(*activityRing)
+	size := uint64(len(r.slots))
+	next := atomic.LoadUint64(&r.next)
+
+	count := next
+	if count > size {
+		count = size
+	}
+	seen := make(map[int64]bool, count)
+	sample := make([]GoID, 0, count)
+	for i := uint64(1); i <= count; i++ {
+		id := atomic.LoadInt64(&r.slots[(next-i)%size])
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			sample = append(sample, GoID(id))
+		}
+	}
+	return sample
+}
@@ -0,0 +1,90 @@
+package goid
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestActiveSample(t *testing.T) {
+	defer SetActivityBufferSize(DefaultActivityBufferSize)
+	SetActivityBufferSize(4)
+
+	if sample := ActiveSample(); len(sample) != 0 {
+		t.Fatalf("expected an empty sample, got %v", sample)
+	}
+
+	RecordActivity()
+	RecordActivity()
+	if sample := ActiveSample(); len(sample) != 1 || sample[0] != GetGoID() {
+		t.Errorf("expected sample [%d], got %v", GetGoID(), sample)
+	}
+
+	// Only the most recent ids are kept
+	ids := make([]GoID, 6)
+	for i := range ids {
+		done := make(chan GoID)
+		go func() {
+			RecordActivity()
+			done <- GetGoID()
+		}()
+		ids[i] = <-done
+	}
+	sample := ActiveSample()
+	if len(sample) != 4 {
+		t.Fatalf("expected 4 ids, got %v", sample)
+	}
+	for i, id := range sample {
+		if expected := ids[len(ids)-1-i]; id != expected {
+			t.Errorf("sample[%d] = %d, expected %d", i, id, expected)
+		}
+	}
+}
+
+func TestRecordActivityConcurrent(t *testing.T) {
+	defer SetActivityBufferSize(DefaultActivityBufferSize)
+	const recorders = 64
+	SetActivityBufferSize(recorders * 100)
+
+	var wg sync.WaitGroup
+	ids := make(chan GoID, recorders)
+	wg.Add(recorders)
+	for i := 0; i < recorders; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				RecordActivity()
+				if j%10 == 0 {
+					_ = ActiveSample()
+				}
+			}
+			ids <- GetGoID()
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	sample := make(map[GoID]bool)
+	for _, id := range ActiveSample() {
+		if sample[id] {
+			t.Errorf("duplicate id %d in sample", id)
+		}
+		sample[id] = true
+	}
+	for id := range ids {
+		if !sample[id] {
+			t.Errorf("recorder %d missing from sample", id)
+		}
+	}
+	if len(sample) != recorders {
+		t.Errorf("expected %d ids in sample, got %d", recorders, len(sample))
+	}
+}
+
+func TestSetActivityBufferSizeInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetActivityBufferSize(0) did not panic")
+		}
+	}()
+	SetActivityBufferSize(0)
+}
@@ -0,0 +1,42 @@
+package goid
+
+// AutoLocal is goroutine-local storage like Local, except that the value of a
+// goroutine is deleted automatically once the goroutine exits, see OnExit. The
+// zero value is ready to use.
+//
+// Cleanup is driven by the exit watcher rather than the garbage collector,
+// since the runtime never frees the "g" of a goroutine, so there is nothing to
+// attach a finalizer to. Neither the goroutine nor its value is kept alive by
+// the cleanup, but values of exited goroutines linger until the next check of
+// the exit watcher, see SetCleanupBounds, and a value set by a goroutine which
+// never exits is never reclaimed.
+type AutoLocal[T any] struct {
+	local Local[T]
+	watch exitWatch
+}
+
+// Get returns the value of the current goroutine, and whether it has one
+func (l *AutoLocal[T]) Get() (T, bool) {
+	return l.local.Get()
+}
+
+// Set sets the value of the current goroutine, which is deleted once the
+// goroutine exits
+func (l *AutoLocal[T]) Set(v T) {
+	l.local.Set(v)
+	id := GetGoID()
+	l.watch.watch(id, func() {
+		l.local.delete(id)
+	})
+}
+
+// Delete removes the value of the current goroutine ahead of its exit
+func (l *AutoLocal[T]) Delete() {
+	l.local.Delete()
+}
+
+// Len returns the number of goroutines with a value, including exited ones
+// whose value wasn't reclaimed yet
+func (l *AutoLocal[T]) Len() int {
+	return l.local.len()
+}
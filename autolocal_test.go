@@ -0,0 +1,58 @@
+package goid
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAutoLocal(t *testing.T) {
+	var l AutoLocal[int]
+	if v, ok := l.Get(); ok {
+		t.Fatalf("expected no value, got %d", v)
+	}
+	l.Set(1)
+	l.Set(2)
+	if v, ok := l.Get(); !ok || v != 2 {
+		t.Errorf("Get() = %d, %v; expected 2, true", v, ok)
+	}
+	l.Delete()
+	if v, ok := l.Get(); ok {
+		t.Errorf("expected no value after Delete, got %d", v)
+	}
+}
+
+func TestAutoLocalCleanup(t *testing.T) {
+	fastExitPolling(t)
+
+	const count = 5000
+	var l AutoLocal[[]byte]
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Set(make([]byte, 64))
+			if _, ok := l.Get(); !ok {
+				t.Errorf("value not set")
+			}
+		}()
+	}
+	wg.Wait()
+	// Some values may already be reclaimed by now
+	if n := l.Len(); n > count {
+		t.Fatalf("expected up to %d values right after the goroutines exited, got %d", count, n)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for l.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the values to be reclaimed, %d left", l.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	l.watch.watched.Range(func(id, _ interface{}) bool {
+		t.Errorf("goroutine %d still watched after its value was reclaimed", id)
+		return false
+	})
+}
@@ -0,0 +1,89 @@
+package goid
+
+import (
+	"fmt"
+	"log"
+)
+
+// RecoveryPolicy tells Barrier what to do with a recovered panic
+type RecoveryPolicy int
+
+const (
+	// RecoverSwallow returns the panic as an error, the default
+	RecoverSwallow RecoveryPolicy = iota
+	// RecoverLog returns the panic as an error and also logs it with the
+	// standard logger
+	RecoverLog
+	// RecoverRepanic panics again with the original panic value
+	RecoverRepanic
+)
+
+// recoveryPolicies holds the recovery policy of each goroutine
+var recoveryPolicies AutoLocal[RecoveryPolicy]
+
+// SetRecoveryPolicy sets the recovery policy of the current goroutine, which
+// Barrier consults when recovering a panic. This lets subsystems running in
+// different goroutines handle panics differently, without global
+// coordination. Goroutines started by Go inherit the policy of their parent.
+// The policy is removed once the goroutine exits, see OnExit.
+func SetRecoveryPolicy(p RecoveryPolicy) {
+	if p == RecoverSwallow {
+		recoveryPolicies.Delete()
+		return
+	}
+	recoveryPolicies.Set(p)
+}
+
+// GetRecoveryPolicy returns the recovery policy of the current goroutine
+func GetRecoveryPolicy() RecoveryPolicy {
+	if p, ok := recoveryPolicies.Get(); ok {
+		return p
+	}
+	return RecoverSwallow
+}
+
+// PanicError is returned by Barrier when the function it runs panics
+type PanicError struct {
+	Value interface{} // The value passed to panic
+	GoID  GoID        // The goroutine that panicked
+	Stack []byte      // The stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("goid: goroutine %d panicked: %v\n%s", e.GoID, e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error, so that errors.Is and
+// errors.As see through a PanicError
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Barrier runs fn synchronously in the current goroutine and returns its
+// error. If fn panics, the panic is recovered and returned as a *PanicError
+// holding the panic value, the goroutine id and the stack trace, so that a
+// misbehaving callback fails the operation rather than the process. The
+// recovery policy of the goroutine may log the panic or panic again instead,
+// see SetRecoveryPolicy.
+func Barrier(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			policy := GetRecoveryPolicy()
+			if policy == RecoverRepanic {
+				panic(r)
+			}
+			err = &PanicError{
+				Value: r,
+				GoID:  GetGoID(),
+				Stack: currentStack(),
+			}
+			if policy == RecoverLog {
+				log.Print(err)
+			}
+		}
+	}()
+	return fn()
+}
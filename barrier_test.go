@@ -0,0 +1,111 @@
+package goid
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBarrier(t *testing.T) {
+	if err := Barrier(func() error { return nil }); err != nil {
+		t.Errorf("Barrier returned %v for a successful function", err)
+	}
+
+	errFailed := errors.New("failed")
+	if err := Barrier(func() error { return errFailed }); err != errFailed {
+		t.Errorf("Barrier returned %v, expected %v", err, errFailed)
+	}
+
+	err := Barrier(func() error { panic("boom") })
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected a *PanicError, got %v", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Errorf("expected panic value %q, got %v", "boom", panicErr.Value)
+	}
+	if gid := GetGoID(); panicErr.GoID != gid {
+		t.Errorf("expected goid %d, got %d", gid, panicErr.GoID)
+	}
+	if !strings.Contains(string(panicErr.Stack), "TestBarrier") {
+		t.Errorf("expected the stack to contain the test function, got %s", panicErr.Stack)
+	}
+	expected := fmt.Sprintf("goroutine %d panicked: boom", panicErr.GoID)
+	if msg := err.Error(); !strings.HasPrefix(msg, "goid: "+expected) {
+		t.Errorf("expected error message to start with %q, got %q", expected, msg)
+	}
+
+	// Panics with an error value can be unwrapped
+	err = Barrier(func() error { panic(errFailed) })
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected %v to wrap %v", err, errFailed)
+	}
+}
+
+func TestRecoveryPolicy(t *testing.T) {
+	defer SetRecoveryPolicy(RecoverSwallow)
+	if p := GetRecoveryPolicy(); p != RecoverSwallow {
+		t.Fatalf("expected default policy RecoverSwallow, got %d", p)
+	}
+
+	// RecoverLog logs the panic and returns it
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	SetRecoveryPolicy(RecoverLog)
+	err := Barrier(func() error { panic("logged") })
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expected a *PanicError with RecoverLog, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "panicked: logged") {
+		t.Errorf("expected the panic to be logged, got %q", buf.String())
+	}
+
+	// RecoverRepanic panics again
+	SetRecoveryPolicy(RecoverRepanic)
+	func() {
+		defer func() {
+			if r := recover(); r != "repanicked" {
+				t.Errorf("expected Barrier to panic again, recovered %v", r)
+			}
+		}()
+		_ = Barrier(func() error { panic("repanicked") })
+		t.Errorf("Barrier returned with RecoverRepanic")
+	}()
+
+	// The policy is isolated to this goroutine
+	done := make(chan error)
+	go func() {
+		done <- Barrier(func() error { panic("other") })
+	}()
+	if err := <-done; !errors.As(err, &panicErr) {
+		t.Errorf("expected another goroutine to get a *PanicError, got %v", err)
+	}
+
+	// Goroutines started by Go inherit it
+	repanicked := make(chan interface{})
+	Go(func() {
+		defer func() {
+			repanicked <- recover()
+		}()
+		_ = Barrier(func() error { panic("inherited") })
+	})
+	if r := <-repanicked; r != "inherited" {
+		t.Errorf("expected a child started by Go to panic again, recovered %v", r)
+	}
+
+	// RecoverSwallow returns the panic without logging it
+	buf.Reset()
+	SetRecoveryPolicy(RecoverSwallow)
+	if err := Barrier(func() error { panic("swallowed") }); !errors.As(err, &panicErr) {
+		t.Errorf("expected a *PanicError with RecoverSwallow, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("RecoverSwallow logged %q", buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+//go:build cgo && (linux || darwin)
+
+package goid
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCgoCallback runs testdata/cgocallback, which calls back into Go from C,
+// on the thread of the cgo call and on a thread of its own, and checks the
+// goroutine ids it reports
+func TestCgoCallback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cgo build in short mode")
+	}
+	args := []string{"run"}
+	if !fastPathEnabled {
+		args = append(args, "-tags", "goid_safe")
+	}
+	run := exec.Command("go", append(args, "./testdata/cgocallback")...)
+	run.Env = append(os.Environ(), "CGO_ENABLED=1")
+	out, err := run.Output()
+	if err != nil {
+		t.Fatalf("cgocallback failed: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the caller id and 2 reports, got %q", out)
+	}
+	caller := lines[0]
+	ids := make([]string, 0, 2)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			t.Fatalf("malformed report %q", line)
+		}
+		if fields[0] != strconv.FormatBool(FastGetGoIDAvailable()) {
+			t.Errorf("expected FastGetGoIDAvailable() = %v, got %q", FastGetGoIDAvailable(), line)
+		}
+		first, _ := strconv.ParseInt(fields[1], 10, 64)
+		if first <= 0 || fields[1] != fields[2] || fields[1] != fields[3] {
+			t.Errorf("expected matching positive ids from GetGoID and the stack, got %q", line)
+		}
+		ids = append(ids, fields[1])
+	}
+
+	// A callback on the thread of the cgo call runs on the calling goroutine,
+	// while one on a C thread runs on a goroutine of its own
+	if ids[0] != caller {
+		t.Errorf("expected the callback on the calling thread to report id %s, got %s", caller, ids[0])
+	}
+	if ids[1] == caller {
+		t.Errorf("expected the callback on a C thread to report an id other than %s", caller)
+	}
+}
@@ -0,0 +1,77 @@
+package goid
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCheckRate is the check rate of GetGoIDChecked, unless changed by
+// SetCheckRate
+const DefaultCheckRate = 1000
+
+var (
+	checkRate     int64 = DefaultCheckRate
+	checkCalls    uint64
+	checkFailed   uint32    // Set once a check failed
+	checkedFastID = fastGid // fastGid, as used by GetGoIDChecked
+	mismatchMu    sync.Mutex
+	mismatchHook  func(fast, slow GoID) = logMismatch
+)
+
+// SetCheckRate makes GetGoIDChecked cross-check the fast path against the slow
+// path on 1 in n calls. Zero disables checking.
+func SetCheckRate(n int) {
+	if n < 0 {
+		panic("goid: negative check rate")
+	}
+	atomic.StoreInt64(&checkRate, int64(n))
+}
+
+// OnCheckMismatch registers fn to be invoked when a check by GetGoIDChecked
+// fails, replacing the default hook, which logs a warning with the standard
+// logger. A nil fn disables reporting.
+func OnCheckMismatch(fn func(fast, slow GoID)) {
+	mismatchMu.Lock()
+	mismatchHook = fn
+	mismatchMu.Unlock()
+}
+
+func logMismatch(fast, slow GoID) {
+	log.Printf("goid: fast path returned goroutine id %d instead of %d, "+
+		"falling back to the slow path", fast, slow)
+}
+
+// GetGoIDChecked gets the current goroutine id like GetGoID, but occasionally
+// cross-checks the fast path against the slow path, see SetCheckRate. Once a
+// check fails, GetGoIDChecked reports the mismatch, see OnCheckMismatch, and
+// permanently falls back to the slow path. This trades a little throughput for
+// protection against an offset which is wrong for some goroutine.
+func GetGoIDChecked() GoID {
+	if !fastPathEnabled || !FastGetGoIDAvailable() {
+		return GetGoID()
+	}
+	if atomic.LoadUint32(&checkFailed) != 0 {
+		return slowGid()
+	}
+	id := checkedFastID()
+	rate := uint64(atomic.LoadInt64(&checkRate))
+	if rate == 0 || atomic.AddUint64(&checkCalls, 1)%rate != 0 {
+		return id
+	}
+	slow := slowGid()
+	if slow == 0 || slow == id {
+		return id
+	}
+	if atomic.CompareAndSwapUint32(&checkFailed, 0, 1) {
+		logf("goid: GetGoIDChecked caught the fast path returning %d instead of %d, "+
+			"falling back to the slow path", id, slow)
+		mismatchMu.Lock()
+		hook := mismatchHook
+		mismatchMu.Unlock()
+		if hook != nil {
+			hook(id, slow)
+		}
+	}
+	return slow
+}
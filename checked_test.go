@@ -0,0 +1,73 @@
+package goid
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetGoIDChecked(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	defer func() {
+		SetCheckRate(DefaultCheckRate)
+		OnCheckMismatch(logMismatch)
+		checkedFastID = fastGid
+		atomic.StoreUint32(&checkFailed, 0)
+	}()
+
+	var mismatches int
+	var fast, slow GoID
+	OnCheckMismatch(func(f, s GoID) {
+		mismatches++
+		fast, slow = f, s
+	})
+
+	SetCheckRate(1)
+	testGid(t, GetGoIDChecked)
+	if mismatches != 0 {
+		t.Fatalf("unexpected mismatch of %d against %d", fast, slow)
+	}
+
+	// Unchecked calls return whatever the fast path returns
+	checkedFastID = func() GoID { return 4711 }
+	SetCheckRate(0)
+	if id := GetGoIDChecked(); id != 4711 {
+		t.Errorf("GetGoIDChecked() = %d without checks, expected the fast path", id)
+	}
+
+	// A failed check falls back to the slow path for good
+	SetCheckRate(1)
+	for i := 0; i < 3; i++ {
+		if id := GetGoIDChecked(); id != slowGid() {
+			t.Errorf("GetGoIDChecked() = %d after a mismatch, expected %d", id, slowGid())
+		}
+	}
+	SetCheckRate(0)
+	if id := GetGoIDChecked(); id != slowGid() {
+		t.Errorf("GetGoIDChecked() = %d with checks disabled after a mismatch, expected %d", id, slowGid())
+	}
+	if mismatches != 1 || fast != 4711 || slow != slowGid() {
+		t.Errorf("expected a single mismatch of 4711 against %d, got %d of %d against %d",
+			slowGid(), mismatches, fast, slow)
+	}
+}
+
+func TestSetCheckRateNegative(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetCheckRate(-1) did not panic")
+		}
+	}()
+	SetCheckRate(-1)
+}
+
+func BenchmarkGetGoIDChecked(b *testing.B) {
+	FastGetGoIDAvailable()
+	b.ReportAllocs()
+	var gid GoID
+	for i := 0; i < b.N; i++ {
+		gid = GetGoIDChecked()
+	}
+	Unused = gid
+}
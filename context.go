@@ -0,0 +1,22 @@
+package goid
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id, typically the id of the
+// goroutine which started handling a request. Later code can compare it to
+// GetGoID to tell whether the work moved to another goroutine.
+func NewContext(ctx context.Context, id GoID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the id stored in ctx by NewContext. Returns false if
+// there is none, or if it is not a valid goroutine id.
+func FromContext(ctx context.Context) (GoID, bool) {
+	id, ok := ctx.Value(contextKey{}).(GoID)
+	if !ok || !id.Valid() {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,44 @@
+package goid
+
+import (
+	"context"
+	"testing"
+)
+
+type otherKey struct{}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id, ok := FromContext(ctx); ok {
+		t.Errorf("FromContext() = %d, true on an empty context", id)
+	}
+
+	ctx = NewContext(ctx, GetGoID())
+	ctx = context.WithValue(ctx, otherKey{}, "other")
+	if id, ok := FromContext(ctx); !ok || id != GetGoID() {
+		t.Errorf("FromContext() = %d, %v; expected %d, true", id, ok, GetGoID())
+	}
+
+	// The innermost id wins, without affecting the parent
+	inner := NewContext(ctx, 4711)
+	if id, ok := FromContext(inner); !ok || id != 4711 {
+		t.Errorf("FromContext() = %d, %v on a nested context; expected 4711, true", id, ok)
+	}
+	if id, _ := FromContext(ctx); id != GetGoID() {
+		t.Errorf("nesting changed the parent id to %d", id)
+	}
+
+	// Work which hopped goroutines is detectable
+	hopped := make(chan bool)
+	go func() {
+		id, _ := FromContext(ctx)
+		hopped <- id != GetGoID()
+	}()
+	if !<-hopped {
+		t.Errorf("expected another goroutine to have a different id than the stored one")
+	}
+
+	if id, ok := FromContext(NewContext(ctx, 0)); ok {
+		t.Errorf("FromContext() = %d, true for a stored zero id", id)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build linux || darwin
+
+package goid
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCShared builds testdata/cshared as a C shared library, calls it from the
+// C program testdata/cshared.c, both on the main thread and on a thread of its
+// own, and checks the goroutine ids it reports
+func TestCShared(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping c-shared build in short mode")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libcshared.so")
+
+	args := []string{"build", "-buildmode=c-shared", "-o", lib}
+	if !fastPathEnabled {
+		args = append(args, "-tags", "goid_safe")
+	}
+	build := exec.Command("go", append(args, "./testdata/cshared")...)
+	build.Env = append(os.Environ(), "CGO_ENABLED=1")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("c-shared build not supported: %v\n%s", err, out)
+	}
+	bin := filepath.Join(dir, "cshared")
+	if out, err := exec.Command(cc, "-o", bin, "testdata/cshared.c",
+		"-I", dir, "-L", dir, "-lcshared", "-lpthread").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the C program: %v\n%s", err, out)
+	}
+
+	run := exec.Command(bin)
+	run.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir, "DYLD_LIBRARY_PATH="+dir)
+	out, err := run.Output()
+	if err != nil {
+		t.Fatalf("C program failed: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 reports, got %q", out)
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			t.Fatalf("malformed report %q", line)
+		}
+		if fields[0] != strconv.FormatBool(FastGetGoIDAvailable()) {
+			t.Errorf("expected FastGetGoIDAvailable() = %v, got %q", FastGetGoIDAvailable(), line)
+		}
+		first, _ := strconv.ParseInt(fields[1], 10, 64)
+		if first <= 0 || fields[1] != fields[2] || fields[1] != fields[3] {
+			t.Errorf("expected matching positive ids from GetGoID and the stack, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package goid
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+)
+
+// dashboardRefreshSeconds is how often the dashboard page reloads itself
+const dashboardRefreshSeconds = 5
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Goroutines</title>
+</head>
+<body>
+<h1>{{len .Goroutines}} goroutines</h1>
+<table>
+<tr><th>ID</th>{{if .Named}}<th>Name</th>{{end}}<th>State</th><th>Wait</th><th>Function</th></tr>
+{{range .Goroutines}}<tr><td>{{.ID}}</td>{{if $.Named}}<td>{{.Name}}</td>{{end}}<td>{{.State}}</td><td>{{.Wait}}</td><td>{{.Function}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// dashboardRow is a row of the dashboard table
+type dashboardRow struct {
+	ID       GoID
+	Name     string // The name of the goroutine in the Registry, if any
+	State    string
+	Wait     string // How long the goroutine has been blocked, if known
+	Function string // The function the goroutine is currently in
+}
+
+// DashboardHandler returns an http.Handler serving an HTML table of the live
+// goroutines, with their id, state, wait time and current function. The page
+// refreshes itself every few seconds. It has no dependencies beyond the
+// standard library, as a minimal ops view for small services.
+//
+// The age of goroutines is not shown, as the runtime doesn't expose when a
+// goroutine started. The wait time only tells how long a blocked goroutine
+// has been blocked, and only once it is over a minute.
+func DashboardHandler() http.Handler {
+	return NamedDashboardHandler(nil)
+}
+
+// NamedDashboardHandler is like DashboardHandler, with an extra column for the
+// names of the goroutines in names, see Registry.Register. A nil names leaves
+// the column out.
+func NamedDashboardHandler(names *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		infos, err := ListGoroutines()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rows := make([]dashboardRow, len(infos))
+		for i, info := range infos {
+			rows[i] = dashboardRow{
+				ID:       info.ID,
+				State:    info.State,
+				Wait:     parseGoroutineWait([]byte(info.Stack)),
+				Function: parseGoroutineFunction([]byte(info.Stack)),
+			}
+			if names != nil {
+				rows[i].Name, _ = names.Name(info.ID)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := dashboardTemplate.Execute(&buf, struct {
+			Refresh    int
+			Named      bool
+			Goroutines []dashboardRow
+		}{dashboardRefreshSeconds, names != nil, rows}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,56 @@
+package goid
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	DashboardHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected an HTML content type, got %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `<meta http-equiv="refresh"`) {
+		t.Errorf("expected the page to refresh itself:\n%s", body)
+	}
+	row := fmt.Sprintf("<tr><td>%d</td><td>running</td>", GetGoID())
+	if !strings.Contains(body, row) {
+		t.Errorf("expected a row starting with %q:\n%s", row, body)
+	}
+}
+
+func TestNamedDashboardHandler(t *testing.T) {
+	var names Registry
+	names.Register("dashboard-test")
+	defer names.Unregister()
+
+	rec := httptest.NewRecorder()
+	NamedDashboardHandler(&names).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<th>Name</th>") {
+		t.Errorf("expected a name column:\n%s", body)
+	}
+	row := fmt.Sprintf("<tr><td>%d</td><td>dashboard-test</td><td>running</td>", GetGoID())
+	if !strings.Contains(body, row) {
+		t.Errorf("expected a row starting with %q:\n%s", row, body)
+	}
+
+	// Without a registry, there is no name column
+	rec = httptest.NewRecorder()
+	DashboardHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); strings.Contains(body, "<th>Name</th>") {
+		t.Errorf("expected no name column without a registry:\n%s", body)
+	}
+}
@@ -0,0 +1,33 @@
+package goid
+
+import "time"
+
+// deadlines holds the soft deadline of each goroutine
+var deadlines AutoLocal[time.Time]
+
+// SetGoroutineDeadline sets a soft deadline for the current goroutine. Deep
+// library code can then check it via DeadlineExceeded, without a context being
+// threaded through. A zero t clears the deadline.
+//
+// Goroutines started by Go inherit the deadline of their parent, those started
+// with a plain go statement don't. The deadline is removed once the goroutine
+// exits, see OnExit.
+func SetGoroutineDeadline(t time.Time) {
+	if t.IsZero() {
+		deadlines.Delete()
+		return
+	}
+	deadlines.Set(t)
+}
+
+// GoroutineDeadline returns the soft deadline of the current goroutine, if any
+func GoroutineDeadline() (time.Time, bool) {
+	return deadlines.Get()
+}
+
+// DeadlineExceeded tells if the current goroutine has a soft deadline and it
+// has passed
+func DeadlineExceeded() bool {
+	t, ok := GoroutineDeadline()
+	return ok && !time.Now().Before(t)
+}
@@ -0,0 +1,56 @@
+package goid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoroutineDeadline(t *testing.T) {
+	if _, ok := GoroutineDeadline(); ok {
+		t.Fatalf("expected no deadline before SetGoroutineDeadline")
+	}
+	if DeadlineExceeded() {
+		t.Fatalf("DeadlineExceeded without a deadline")
+	}
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	SetGoroutineDeadline(deadline)
+	defer SetGoroutineDeadline(time.Time{})
+
+	if d, ok := GoroutineDeadline(); !ok || !d.Equal(deadline) {
+		t.Fatalf("GoroutineDeadline() = %v, %v; expected %v, true", d, ok, deadline)
+	}
+	if DeadlineExceeded() {
+		t.Fatalf("DeadlineExceeded before the deadline")
+	}
+
+	// The deadline is isolated to this goroutine
+	done := make(chan bool)
+	go func() {
+		_, ok := GoroutineDeadline()
+		done <- ok
+	}()
+	if <-done {
+		t.Errorf("deadline leaked into another goroutine")
+	}
+
+	// Goroutines started by Go inherit it
+	inherited := make(chan time.Time)
+	Go(func() {
+		d, _ := GoroutineDeadline()
+		inherited <- d
+	})
+	if d := <-inherited; !d.Equal(deadline) {
+		t.Errorf("GoroutineDeadline() in a child started by Go = %v, expected %v", d, deadline)
+	}
+
+	time.Sleep(time.Until(deadline) + 10*time.Millisecond)
+	if !DeadlineExceeded() {
+		t.Errorf("DeadlineExceeded did not flip after the deadline passed")
+	}
+
+	SetGoroutineDeadline(time.Time{})
+	if _, ok := GoroutineDeadline(); ok {
+		t.Errorf("zero deadline did not clear the deadline")
+	}
+}
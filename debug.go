@@ -0,0 +1,26 @@
+package goid
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// debugEnv names the environment variable which, when set to 1, makes offset
+// detection print a diagnostic line to stderr once it completes
+const debugEnv = "GOID_DEBUG"
+
+// debugOutput is where the line of GOID_DEBUG goes
+var debugOutput io.Writer = os.Stderr
+
+// printDebugLine prints the outcome of the last offset detection on a single
+// line, for bug reports: the Go version and platform, the offset, whether the
+// fast path is available, the votes for each candidate offset and the error
+func printDebugLine(w io.Writer) {
+	detectionMu.Lock()
+	d := detection
+	detectionMu.Unlock()
+	fmt.Fprintln(w, "goid:", runtime.Version(), runtime.GOOS+"/"+runtime.GOARCH,
+		fmt.Sprintf("offset=%d fast=%t votes=%v err=%v", d.offset, d.offset >= 0, d.candidates, d.err))
+}
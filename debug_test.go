@@ -0,0 +1,43 @@
+package goid
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDebugLine(t *testing.T) {
+	var buf bytes.Buffer
+	debugOutput = &buf
+	defer func() {
+		debugOutput = os.Stderr
+	}()
+
+	offset := DetectedOffset()
+	resolveGidOffset()
+	if buf.Len() != 0 {
+		t.Errorf("expected no output without %s, got %q", debugEnv, buf.String())
+	}
+
+	t.Setenv(debugEnv, "1")
+	resolveGidOffset()
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("expected a single line, got %q", line)
+	}
+	for _, field := range []string{
+		runtime.Version(),
+		runtime.GOOS + "/" + runtime.GOARCH,
+		fmt.Sprintf("offset=%d", offset),
+		fmt.Sprintf("fast=%t", offset >= 0),
+		"votes=",
+		"err=",
+	} {
+		if !strings.Contains(line, field) {
+			t.Errorf("expected %q in %q", field, line)
+		}
+	}
+}
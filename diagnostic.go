@@ -0,0 +1,48 @@
+package goid
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// diagnostic describes a goroutine, see DiagnosticJSON
+type diagnostic struct {
+	GoID     GoID              `json:"goid"`
+	Name     string            `json:"name,omitempty"`
+	State    string            `json:"state,omitempty"`
+	Deadline *time.Time        `json:"deadline,omitempty"`
+	MDC      map[string]string `json:"mdc,omitempty"`
+	Stack    string            `json:"stack,omitempty"`
+}
+
+// DiagnosticJSON returns a JSON object describing the current goroutine, for
+// embedding in error reports or panic handlers. It holds the goroutine id as
+// "goid", its scheduler state as "state", its soft deadline as "deadline", its
+// mapped diagnostic context as "mdc" and its stack trace as "stack". Fields
+// which aren't available are omitted.
+//
+// The age of the goroutine is not included, as the runtime doesn't expose
+// when a goroutine started. See NamedDiagnosticJSON for its name.
+func DiagnosticJSON() ([]byte, error) {
+	return NamedDiagnosticJSON(nil)
+}
+
+// NamedDiagnosticJSON is like DiagnosticJSON, and also holds the name of the
+// current goroutine in names as "name", see Registry.Register. A nil names
+// leaves it out.
+func NamedDiagnosticJSON(names *Registry) ([]byte, error) {
+	stack := currentStack()
+	d := diagnostic{
+		GoID:  GetGoID(),
+		State: parseGoroutineState(stack),
+		MDC:   MDC(),
+		Stack: string(stack),
+	}
+	if names != nil {
+		d.Name, _ = names.Name(d.GoID)
+	}
+	if deadline, ok := GoroutineDeadline(); ok {
+		d.Deadline = &deadline
+	}
+	return json.Marshal(d)
+}
@@ -0,0 +1,85 @@
+package goid
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticJSON(t *testing.T) {
+	done := make(chan map[string]interface{})
+	go func() {
+		b, err := DiagnosticJSON()
+		if err != nil {
+			t.Errorf("DiagnosticJSON failed: %v", err)
+		}
+		var d map[string]interface{}
+		if err := json.Unmarshal(b, &d); err != nil {
+			t.Errorf("DiagnosticJSON returned invalid JSON %q: %v", b, err)
+		}
+		d["expected_goid"] = float64(GetGoID())
+		done <- d
+	}()
+	d := <-done
+
+	if d["goid"] == nil || d["goid"] != d["expected_goid"] {
+		t.Errorf("expected goid %v, got %v", d["expected_goid"], d["goid"])
+	}
+	if d["state"] != "running" {
+		t.Errorf("expected state running, got %v", d["state"])
+	}
+	if stack, _ := d["stack"].(string); !strings.Contains(stack, "TestDiagnosticJSON") {
+		t.Errorf("expected stack to contain the test function, got %q", stack)
+	}
+	for _, field := range []string{"name", "mdc", "deadline"} {
+		if _, ok := d[field]; ok {
+			t.Errorf("expected unavailable field %q to be omitted", field)
+		}
+	}
+}
+
+func TestDiagnosticJSONOptionalFields(t *testing.T) {
+	PutMDC("request_id", "r1")
+	defer ClearMDC()
+	SetGoroutineDeadline(time.Now().Add(time.Hour))
+	defer SetGoroutineDeadline(time.Time{})
+
+	b, err := DiagnosticJSON()
+	if err != nil {
+		t.Fatalf("DiagnosticJSON failed: %v", err)
+	}
+	var d struct {
+		MDC      map[string]string `json:"mdc"`
+		Deadline *time.Time        `json:"deadline"`
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatalf("DiagnosticJSON returned invalid JSON %q: %v", b, err)
+	}
+	if d.MDC["request_id"] != "r1" {
+		t.Errorf("expected mdc request_id r1, got %v", d.MDC)
+	}
+	if d.Deadline == nil {
+		t.Errorf("expected a deadline")
+	}
+}
+
+func TestNamedDiagnosticJSON(t *testing.T) {
+	var names Registry
+	names.Register("diagnosed")
+	defer names.Unregister()
+
+	b, err := NamedDiagnosticJSON(&names)
+	if err != nil {
+		t.Fatalf("NamedDiagnosticJSON failed: %v", err)
+	}
+	var d struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatalf("NamedDiagnosticJSON returned invalid JSON %q: %v", b, err)
+	}
+	if d.Name != "diagnosed" {
+		t.Errorf("expected name diagnosed, got %q", d.Name)
+	}
+}
@@ -0,0 +1,506 @@
+package goid
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrDumpUnparsable is returned when no goroutine could be parsed out of the
+// stack dump of all goroutines
+var ErrDumpUnparsable = errors.New("goid: could not parse goroutine stack dump")
+
+// GoroutineInfo describes a goroutine, as parsed from a stack dump
+type GoroutineInfo struct {
+	ID       GoID
+	State    string // Scheduler state, such as "running" or "chan receive"
+	Function string // Function of the topmost frame, such as "main.main"
+	Parent   GoID   // Id of the creator, 0 if unknown, see ParentGoID
+	// Stack trace, including the "goroutine N [" header. Snapshot and
+	// SnapshotByState leave it empty to save memory, as does Leaked without
+	// WithStacks, so an empty Stack doesn't mean that parsing failed.
+	Stack string
+}
+
+// Frame is a call frame of a goroutine stack, as parsed from a stack dump
+type Frame struct {
+	Function string // Such as "main.main" or "main.(*T).run"
+	File     string // Full path of the source file
+	Line     int
+}
+
+// Frames parses the call frames out of Stack, topmost first, leaving out the
+// "created by" site. Returns nil if Stack is empty.
+//
+// The frames are parsed on demand rather than stored in GoroutineInfo, so that
+// GoroutineInfo stays comparable and dumps which are only scanned don't pay
+// for parsing every frame.
+func (info GoroutineInfo) Frames() []Frame {
+	return parseFrames(info.Stack)
+}
+
+// parseFrames parses the frames of a stack in the runtime.Stack format: pairs
+// of a function line, with its arguments, and a tab-indented "file:line +0x1d"
+// line. Lines which don't fit, such as the header or
+// "...additional frames elided...", are skipped.
+func parseFrames(stack string) []Frame {
+	lines := strings.Split(stack, "\n")
+	var frames []Frame
+	for i := 0; i+1 < len(lines); i++ {
+		function, location := lines[i], lines[i+1]
+		if strings.HasPrefix(function, "created by ") {
+			break
+		}
+		if strings.HasPrefix(function, "\t") || !strings.HasPrefix(location, "\t") {
+			continue
+		}
+		if end := strings.LastIndexByte(function, '('); end > 0 {
+			function = function[:end]
+		}
+		location = location[1:]
+		if end := strings.LastIndex(location, " +0x"); end >= 0 {
+			location = location[:end]
+		}
+		frame := Frame{Function: function, File: location}
+		if end := strings.LastIndexByte(location, ':'); end >= 0 {
+			if line, err := strconv.Atoi(location[end+1:]); err == nil {
+				frame.File, frame.Line = location[:end], line
+			}
+		}
+		frames = append(frames, frame)
+		i++
+	}
+	return frames
+}
+
+// newGoroutineInfo parses the GoroutineInfo of the goroutine with the given id
+// out of its block in a stack dump
+func newGoroutineInfo(id GoID, block []byte) GoroutineInfo {
+	return GoroutineInfo{
+		ID:       id,
+		State:    parseGoroutineState(block),
+		Function: parseGoroutineFunction(block),
+		Parent:   parseGoroutineCreator(block),
+		Stack:    string(bytes.TrimSuffix(block, []byte("\n"))),
+	}
+}
+
+const dumpBufSize = 64 << 10 // Initial size of all-goroutine dump buffers
+
+// dumpBufPool holds buffers for all-goroutine stack dumps, so that repeated
+// dumps don't have to grow a fresh buffer every time
+var dumpBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, dumpBufSize)
+		return &buf
+	},
+}
+
+// withDump calls runtime.Stack for all goroutines into a pooled buffer, growing
+// it until the dump fits, and passes the dump to fn. The dump must not be
+// retained after fn returns.
+func withDump(fn func(dump []byte)) {
+	bufp := dumpBufPool.Get().(*[]byte)
+	defer dumpBufPool.Put(bufp)
+
+	for {
+		if n := runtime.Stack(*bufp, true); n < len(*bufp) {
+			fn((*bufp)[:n])
+			return
+		}
+		*bufp = make([]byte, 2*len(*bufp))
+	}
+}
+
+// currentStack returns the stack of the current goroutine, growing the buffer
+// until it fits
+func currentStack() []byte {
+	buf := make([]byte, 1024)
+	for {
+		if n := runtime.Stack(buf, false); n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// forEachGoroutine calls fn with the id and the block of every goroutine in
+// dump, in dump order, until fn returns false. Blocks which don't start with a
+// "goroutine N [" header are skipped. Returns false if no block could be
+// parsed.
+func forEachGoroutine(dump []byte, fn func(id GoID, block []byte) bool) bool {
+	return forEachGoroutineAt(dump, func(id GoID, start, end int) bool {
+		return fn(id, dump[start:end])
+	})
+}
+
+// forEachGoroutineAt is like forEachGoroutine, but passes the bounds of each
+// block within dump instead of the block itself
+func forEachGoroutineAt(dump []byte, fn func(id GoID, start, end int) bool) bool {
+	parsed := false
+	for start := 0; start < len(dump); {
+		end, next := len(dump), len(dump)
+		if i := bytes.Index(dump[start:], []byte("\n\n")); i >= 0 {
+			end, next = start+i+1, start+i+2
+		}
+
+		if id, ok := parseGoroutineHeader(dump[start:end]); ok {
+			parsed = true
+			if !fn(id, start, end) {
+				break
+			}
+		}
+		start = next
+	}
+	return parsed
+}
+
+// parseGoroutineHeader parses the 4707 out of a "goroutine 4707 [" header at
+// the beginning of b
+func parseGoroutineHeader(b []byte) (GoID, bool) {
+	if !bytes.HasPrefix(b, []byte(goroutinePrefix)) {
+		return 0, false
+	}
+	b = b[len(goroutinePrefix):]
+
+	var id GoID
+	i := 0
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		d := GoID(b[i] - '0')
+		if id > (1<<63-1-d)/10 {
+			return 0, false // Overflow
+		}
+		id = id*10 + d
+	}
+	if i == 0 || i == len(b) || b[i] != ' ' {
+		return 0, false
+	}
+	return id, true
+}
+
+// parseGoroutineState parses the "chan receive" out of a
+// "goroutine 4707 [chan receive, 2 minutes]:" header at the beginning of b.
+// Returns an empty string if the header can't be parsed.
+func parseGoroutineState(b []byte) string {
+	if end := bytes.IndexByte(b, '\n'); end >= 0 {
+		b = b[:end]
+	}
+	start := bytes.IndexByte(b, '[')
+	if start < 0 {
+		return ""
+	}
+	b = b[start+1:]
+	end := bytes.IndexAny(b, ",]")
+	if end < 0 {
+		return ""
+	}
+	if state, ok := commonStates[string(b[:end])]; ok {
+		return state
+	}
+	return string(b[:end])
+}
+
+// commonStates interns frequent goroutine states, so that parsing them doesn't
+// allocate
+var commonStates = func() map[string]string {
+	states := make(map[string]string)
+	for _, state := range []string{
+		"running", "runnable", "syscall", "sleep", "select", "select (no cases)",
+		"chan receive", "chan send", "chan receive (nil chan)",
+		"chan send (nil chan)", "IO wait", "semacquire", "sync.Mutex.Lock",
+		"sync.RWMutex.Lock", "sync.RWMutex.RLock", "sync.Cond.Wait",
+		"sync.WaitGroup.Wait", "GC worker (idle)", "finalizer wait",
+		"force gc (idle)", "GC sweep wait", "GC scavenge wait",
+	} {
+		states[state] = state
+	}
+	return states
+}()
+
+// parseGoroutineWait parses the "2 minutes" out of a
+// "goroutine 4707 [chan receive, 2 minutes]:" header at the beginning of b.
+// Returns an empty string if the header has no wait time.
+func parseGoroutineWait(b []byte) string {
+	if end := bytes.IndexByte(b, '\n'); end >= 0 {
+		b = b[:end]
+	}
+	start := bytes.IndexByte(b, '[')
+	end := bytes.LastIndexByte(b, ']')
+	if start < 0 || end < start {
+		return ""
+	}
+	for _, field := range strings.Split(string(b[start+1:end]), ", ") {
+		if strings.HasSuffix(field, " minutes") {
+			return field
+		}
+	}
+	return ""
+}
+
+// parseGoroutineFunction parses the function of the topmost frame out of the
+// block of a goroutine in a stack dump, e.g. "main.main" out of
+// "goroutine 1 [running]:\nmain.main()\n". Returns an empty string if there is
+// no frame.
+func parseGoroutineFunction(block []byte) string {
+	start, end := goroutineFunctionBounds(block)
+	return string(block[start:end])
+}
+
+// goroutineFunctionBounds returns the bounds of the function parsed by
+// parseGoroutineFunction within block
+func goroutineFunctionBounds(block []byte) (start, end int) {
+	header := bytes.IndexByte(block, '\n')
+	if header < 0 {
+		return 0, 0
+	}
+	start = header + 1
+	end = len(block)
+	if i := bytes.IndexByte(block[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+	if i := bytes.LastIndexByte(block[start:end], '('); i > 0 {
+		end = start + i
+	}
+	return start, end
+}
+
+// parseGoroutineCreatedBy parses the creation site out of the block of a
+// goroutine in a stack dump, e.g. "main.main" and "/src/main.go:12" out of
+// "created by main.main in goroutine 1\n\t/src/main.go:12 +0x1d\n". Returns
+// empty strings if there is no "created by" line, as for the main goroutine.
+func parseGoroutineCreatedBy(block []byte) (function, location string) {
+	const createdBy = "\ncreated by "
+	start := bytes.Index(block, []byte(createdBy))
+	if start < 0 {
+		return "", ""
+	}
+	lines := bytes.SplitN(block[start+len(createdBy):], []byte("\n"), 3)
+
+	function = string(lines[0])
+	if end := strings.Index(function, " in goroutine "); end >= 0 {
+		function = function[:end]
+	}
+	if len(lines) > 1 {
+		location = strings.TrimSpace(string(lines[1]))
+		if end := strings.LastIndex(location, " +0x"); end >= 0 {
+			location = location[:end]
+		}
+	}
+	return function, location
+}
+
+// parseGoroutineParent parses the id of the creator out of the block of a
+// goroutine in a stack dump, e.g. 1 out of "created by main.main in goroutine
+// 1". Returns false if there is no "created by" line, as for the main
+// goroutine, or if it lacks the "in goroutine N" suffix, which Go versions
+// before 1.21 did not emit.
+func parseGoroutineParent(block []byte) (GoID, bool) {
+	const createdBy, in = "\ncreated by ", " in goroutine "
+	start := bytes.Index(block, []byte(createdBy))
+	if start < 0 {
+		return 0, false
+	}
+	line := block[start+len(createdBy):]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	i := bytes.LastIndex(line, []byte(in))
+	if i < 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(string(bytes.TrimSpace(line[i+len(in):])), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return GoID(id), true
+}
+
+// parseGoroutineCreator is like parseGoroutineParent, but returns 0 if the
+// creator is unknown
+func parseGoroutineCreator(block []byte) GoID {
+	id, _ := parseGoroutineParent(block)
+	return id
+}
+
+// ParentGoID returns the id of the goroutine which created the current one,
+// from the "created by" line of the current stack. Returns false for the main
+// goroutine and for goroutines created by the runtime, which have no creator,
+// and on Go versions before 1.21, which do not report the creator's id.
+func ParentGoID() (GoID, bool) {
+	return parseGoroutineParent(currentStack())
+}
+
+// State returns the scheduler state of the current goroutine, as parsed from
+// the "goroutine N [state]:" header of its stack, or an empty string if the
+// header can't be parsed. For the calling goroutine this is essentially
+// always "running". See Snapshot for the states of all goroutines.
+func State() string {
+	return readState(runtime.Stack)
+}
+
+// readState parses the state out of the stack header written by stack
+func readState(stack func(buf []byte, all bool) int) string {
+	var buf [128]byte // Fits the header of any id, with a short state
+	return parseGoroutineState(buf[:stack(buf[:], false)])
+}
+
+// ListGoroutines returns all live goroutines, in stack dump order. The result
+// is a snapshot and inherently racy.
+func ListGoroutines() (infos []GoroutineInfo, err error) {
+	withDump(func(dump []byte) {
+		var ok bool
+		if infos, ok = parseGoroutines(dump); !ok {
+			err = ErrDumpUnparsable
+		}
+	})
+	return infos, err
+}
+
+// parseGoroutines parses all goroutines out of dump. Returns false if no
+// goroutine could be parsed.
+//
+// To keep allocations down for large dumps, the stacks of all goroutines are
+// substrings of a single copy of dump, and common states are interned.
+func parseGoroutines(dump []byte) ([]GoroutineInfo, bool) {
+	str := string(dump)
+	infos := make([]GoroutineInfo, 0, bytes.Count(dump, []byte("\n\n"))+1)
+	ok := forEachGoroutineAt(dump, func(id GoID, start, end int) bool {
+		fnStart, fnEnd := goroutineFunctionBounds(dump[start:end])
+		infos = append(infos, GoroutineInfo{
+			ID:       id,
+			State:    parseGoroutineState(dump[start:end]),
+			Function: str[start+fnStart : start+fnEnd],
+			Parent:   parseGoroutineCreator(dump[start:end]),
+			Stack:    strings.TrimSuffix(str[start:end], "\n"),
+		})
+		return true
+	})
+	return infos, ok
+}
+
+// Snapshot returns the id, state, topmost function and creator of all live
+// goroutines, in stack dump order, out of a single stack dump. Unlike
+// ListGoroutines, it leaves out the stacks, so it is lighter on memory. The
+// result is a snapshot and inherently racy.
+//
+// It returns the GoroutineInfo of ListGoroutines rather than a type of its own,
+// so that the results of both mix, as baselines of Leaked and BuildTree
+// inputs, and ErrDumpUnparsable rather than an empty list when the dump can't
+// be parsed.
+func Snapshot() ([]GoroutineInfo, error) {
+	return snapshot(func(string) bool { return true })
+}
+
+// SnapshotByState is like Snapshot, but only returns the goroutines whose state
+// starts with state, so that "chan receive" also matches
+// "chan receive (nil chan)". It helps find the goroutines involved in a
+// deadlock, for instance.
+func SnapshotByState(state string) ([]GoroutineInfo, error) {
+	return snapshot(func(s string) bool {
+		return strings.HasPrefix(s, state)
+	})
+}
+
+// snapshot implements Snapshot, for the goroutines whose state passes match
+func snapshot(match func(state string) bool) (infos []GoroutineInfo, err error) {
+	withDump(func(dump []byte) {
+		if !forEachGoroutine(dump, func(id GoID, block []byte) bool {
+			if state := parseGoroutineState(block); match(state) {
+				infos = append(infos, GoroutineInfo{
+					ID:       id,
+					State:    state,
+					Function: parseGoroutineFunction(block),
+					Parent:   parseGoroutineCreator(block),
+				})
+			}
+			return true
+		}) {
+			infos, err = nil, ErrDumpUnparsable
+		}
+	})
+	return infos, err
+}
+
+// GoIDRange returns the smallest and largest ids of the live goroutines, out
+// of a single stack dump. A wide range with few goroutines hints at a mix of
+// long-lived and bursty goroutines.
+func GoIDRange() (min, max GoID, err error) {
+	withDump(func(dump []byte) {
+		if !forEachGoroutine(dump, func(id GoID, _ []byte) bool {
+			if min == 0 || id < min {
+				min = id
+			}
+			if id > max {
+				max = id
+			}
+			return true
+		}) {
+			err = ErrDumpUnparsable
+		}
+	})
+	return min, max, err
+}
+
+// AllGoIDs returns the ids of all live goroutines, in stack dump order, or nil
+// if the dump could not be parsed. The result is a snapshot and inherently
+// racy: goroutines may exit or be spawned right after.
+func AllGoIDs() (ids []GoID) {
+	withDump(func(dump []byte) {
+		ids = make([]GoID, 0, bytes.Count(dump, []byte("\n\n"))+1)
+		if !forEachGoroutine(dump, func(id GoID, _ []byte) bool {
+			ids = append(ids, id)
+			return true
+		}) {
+			ids = nil
+		}
+	})
+	return ids
+}
+
+// findGoroutine returns the state of the goroutine with the given id, stopping
+// parsing as soon as it is found
+func findGoroutine(id GoID) (state string, alive bool, err error) {
+	withDump(func(dump []byte) {
+		parsed := forEachGoroutine(dump, func(gid GoID, block []byte) bool {
+			if gid != id {
+				return true
+			}
+			state, alive = parseGoroutineState(block), true
+			return false
+		})
+		if !parsed {
+			err = ErrDumpUnparsable
+		}
+	})
+	return state, alive, err
+}
+
+// StackForGoID returns the stack trace of the goroutine with the given id,
+// including its "goroutine N [" header, out of a dump of all goroutines.
+// Returns false if no goroutine with that id currently exists. Like
+// AllGoIDs, it grows the dump buffer until the dump is not truncated.
+func StackForGoID(id GoID) (stack []byte, found bool) {
+	withDump(func(dump []byte) {
+		forEachGoroutine(dump, func(gid GoID, block []byte) bool {
+			if gid != id {
+				return true
+			}
+			stack = append([]byte(nil), bytes.TrimSuffix(block, []byte("\n"))...)
+			found = true
+			return false
+		})
+	})
+	return stack, found
+}
+
+// IsAlive tells if a goroutine with the given id currently exists. Parsing
+// stops as soon as the id is found, so this is cheaper than enumerating all
+// goroutines. The result is a snapshot and may be stale by the time it is
+// returned.
+func IsAlive(id GoID) (bool, error) {
+	_, alive, err := findGoroutine(id)
+	return alive, err
+}
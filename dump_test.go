@@ -0,0 +1,635 @@
+package goid
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseGoroutineHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		id     GoID
+		ok     bool
+	}{
+		{"goroutine 1 [running]:", 1, true},
+		{"goroutine 4707 [chan receive, 2 minutes]:", 4707, true},
+		{"goroutine 9223372036854775807 [running]:", 9223372036854775807, true},
+		{"goroutine 9223372036854775808 [running]:", 0, false},
+		{"goroutine 12", 0, false},
+		{"goroutine  12 [running]:", 0, false},
+		{"goroutine x [running]:", 0, false},
+		{"created by main.main in goroutine 1", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		id, ok := parseGoroutineHeader([]byte(test.header))
+		if id != test.id || ok != test.ok {
+			t.Errorf("parseGoroutineHeader(%q) = %d, %v; expected %d, %v",
+				test.header, id, ok, test.id, test.ok)
+		}
+	}
+}
+
+func TestParseGoroutineState(t *testing.T) {
+	tests := []struct {
+		header string
+		state  string
+	}{
+		{"goroutine 1 [running]:\nmain.main()", "running"},
+		{"goroutine 7 [chan receive]:", "chan receive"},
+		{"goroutine 7 [chan receive, 2 minutes]:", "chan receive"},
+		{"goroutine 7 [chan receive (nil chan)]:", "chan receive (nil chan)"},
+		{"goroutine 7 [select, locked to thread]:", "select"},
+		{"goroutine 7 [running", ""},
+		{"goroutine 7:\nmain.f() [", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if state := parseGoroutineState([]byte(test.header)); state != test.state {
+			t.Errorf("parseGoroutineState(%q) = %q, expected %q", test.header, state, test.state)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	if state := State(); state != "running" {
+		t.Errorf("State() = %q, expected \"running\"", state)
+	}
+
+	for header, expected := range map[string]string{
+		"goroutine 4707 [running]:\nmain.main()\n":                 "running",
+		"goroutine 4707 [running, locked to thread]:\nmain.main()": "running",
+		"goroutine 4707 [runn":                                     "",
+		"fake 4707 running\n":                                      "",
+	} {
+		stack := func(buf []byte, all bool) int {
+			return copy(buf, header)
+		}
+		if state := readState(stack); state != expected {
+			t.Errorf("readState(%q) = %q, expected %q", header, state, expected)
+		}
+	}
+}
+
+func TestParseGoroutineWait(t *testing.T) {
+	tests := []struct {
+		header string
+		wait   string
+	}{
+		{"goroutine 7 [chan receive, 2 minutes]:\nmain.f()", "2 minutes"},
+		{"goroutine 7 [select, 15 minutes, locked to thread]:", "15 minutes"},
+		{"goroutine 7 [chan receive]:", ""},
+		{"goroutine 7 [running]:", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if wait := parseGoroutineWait([]byte(test.header)); wait != test.wait {
+			t.Errorf("parseGoroutineWait(%q) = %q, expected %q", test.header, wait, test.wait)
+		}
+	}
+}
+
+func TestParseGoroutineFunction(t *testing.T) {
+	tests := []struct {
+		block    string
+		function string
+	}{
+		{"goroutine 1 [running]:\nmain.main()\n\tmain.go:5 +0x1\n", "main.main"},
+		{"goroutine 7 [chan receive]:\nmain.(*T).f(0xc000010000)\n\tmain.go:9 +0x1\n", "main.(*T).f"},
+		{"goroutine 7 [running]:\n", ""},
+		{"goroutine 7 [running]:", ""},
+	}
+	for _, test := range tests {
+		if function := parseGoroutineFunction([]byte(test.block)); function != test.function {
+			t.Errorf("parseGoroutineFunction(%q) = %q, expected %q", test.block, function, test.function)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	info := GoroutineInfo{Stack: "goroutine 7 [chan receive]:\n" +
+		"main.(*T).f(0xc000010000, {0x4711, 0x2})\n\t/src/main.go:9 +0x1d\n" +
+		"main.g(...)\n\t/src/main.go:14\n" +
+		"...additional frames elided...\n" +
+		"main.h()\n\tC:/src/main.go:20 +0x3\n" +
+		"created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d"}
+	expected := []Frame{
+		{"main.(*T).f", "/src/main.go", 9},
+		{"main.g", "/src/main.go", 14},
+		{"main.h", "C:/src/main.go", 20},
+	}
+	frames := info.Frames()
+	if len(frames) != len(expected) {
+		t.Fatalf("Frames() = %+v, expected %+v", frames, expected)
+	}
+	for i := range frames {
+		if frames[i] != expected[i] {
+			t.Errorf("frame %d = %+v, expected %+v", i, frames[i], expected[i])
+		}
+	}
+
+	if frames := (GoroutineInfo{}).Frames(); frames != nil {
+		t.Errorf("Frames() of an empty stack = %+v, expected nil", frames)
+	}
+}
+
+func TestParseGoroutineCreatedBy(t *testing.T) {
+	tests := []struct {
+		block    string
+		function string
+		location string
+	}{
+		{
+			"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+				"created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d\n",
+			"main.main", "/src/main.go:4",
+		},
+		{
+			"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+				"created by main.main\n\t/src/main.go:4 +0x1d\n",
+			"main.main", "/src/main.go:4",
+		},
+		{
+			"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+				"created by main.main in goroutine 1\n\t/src/main.go:4\n",
+			"main.main", "/src/main.go:4",
+		},
+		{"goroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1\n", "", ""},
+	}
+	for _, test := range tests {
+		function, location := parseGoroutineCreatedBy([]byte(test.block))
+		if function != test.function || location != test.location {
+			t.Errorf("parseGoroutineCreatedBy(%q) = %q, %q; expected %q, %q",
+				test.block, function, location, test.function, test.location)
+		}
+	}
+}
+
+func TestParseGoroutineParent(t *testing.T) {
+	tests := []struct {
+		block string
+		id    GoID
+		ok    bool
+	}{
+		{"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+			"created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d\n", 1, true},
+		{"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+			"created by main.g in goroutine 4711", 4711, true},
+		// Before Go 1.21
+		{"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+			"created by main.main\n\t/src/main.go:4 +0x1d\n", 0, false},
+		{"goroutine 7 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+			"created by main.main in goroutine x\n\t/src/main.go:4 +0x1d\n", 0, false},
+		{"goroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1\n", 0, false},
+	}
+	for _, test := range tests {
+		if id, ok := parseGoroutineParent([]byte(test.block)); id != test.id || ok != test.ok {
+			t.Errorf("parseGoroutineParent(%q) = %d, %v; expected %d, %v",
+				test.block, id, ok, test.id, test.ok)
+		}
+	}
+}
+
+// Package initialization runs on the main goroutine
+var initParentGoID, initHasParent = ParentGoID()
+
+func TestParentGoID(t *testing.T) {
+	if initHasParent {
+		t.Errorf("ParentGoID() = %d, true on the main goroutine, expected false", initParentGoID)
+	}
+
+	parent := GetGoID()
+	type result struct {
+		id GoID
+		ok bool
+	}
+	done := make(chan result)
+	go func() {
+		id, ok := ParentGoID()
+		done <- result{id, ok}
+	}()
+	if r := <-done; !r.ok || r.id != parent {
+		t.Errorf("ParentGoID() = %d, %v; expected %d, true", r.id, r.ok, parent)
+	}
+}
+
+func TestForEachGoroutine(t *testing.T) {
+	dump := []byte("goroutine 1 [running]:\nmain.main()\n\tmain.go:5 +0x1\n\n" +
+		"garbage\n\n" +
+		"goroutine 7 [chan receive]:\nmain.f()\n\tmain.go:9 +0x1\n" +
+		"created by main.main in goroutine 1\n\tmain.go:4 +0x1\n\n" +
+		"goroutine 9 [select]:\nmain.g()\n\tmain.go:12 +0x1\n")
+
+	var ids []GoID
+	if !forEachGoroutine(dump, func(id GoID, block []byte) bool {
+		ids = append(ids, id)
+		return true
+	}) {
+		t.Fatalf("forEachGoroutine parsed nothing")
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 7 || ids[2] != 9 {
+		t.Errorf("expected ids [1 7 9], got %v", ids)
+	}
+
+	// Stops when fn returns false
+	ids = nil
+	forEachGoroutine(dump, func(id GoID, block []byte) bool {
+		ids = append(ids, id)
+		return false
+	})
+	if len(ids) != 1 {
+		t.Errorf("expected forEachGoroutine to stop after 1 goroutine, got %v", ids)
+	}
+
+	if forEachGoroutine([]byte("garbage\n\nmore garbage\n"), func(GoID, []byte) bool {
+		return true
+	}) {
+		t.Errorf("forEachGoroutine parsed garbage")
+	}
+}
+
+func TestIsAlive(t *testing.T) {
+	idCh := make(chan GoID)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		idCh <- slowGid()
+		<-stop
+	}()
+	id := <-idCh
+
+	if alive, err := IsAlive(id); err != nil || !alive {
+		t.Fatalf("IsAlive(%d) = %v, %v; expected true, nil", id, alive, err)
+	}
+
+	close(stop)
+	<-done
+	// The goroutine may take a moment to fully exit after closing done
+	for i := 0; ; i++ {
+		alive, err := IsAlive(id)
+		if err != nil {
+			t.Fatalf("IsAlive(%d) failed: %v", id, err)
+		}
+		if !alive {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("IsAlive(%d) still true after the goroutine finished", id)
+		}
+		runtime.Gosched()
+	}
+
+	// let parsing fail
+	fakeGoroutinePrefix(t)
+	if _, err := IsAlive(id); !errors.Is(err, ErrDumpUnparsable) {
+		t.Errorf("expected ErrDumpUnparsable, got %v", err)
+	}
+}
+
+func blockForStackTest(stop chan struct{}) {
+	<-stop
+}
+
+func TestStackForGoID(t *testing.T) {
+	idCh := make(chan GoID)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		idCh <- GetGoID()
+		blockForStackTest(stop)
+	}()
+	id := <-idCh
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Wait for the goroutine to block in blockForStackTest
+	for i := 0; ; i++ {
+		stack, ok := StackForGoID(id)
+		if !ok {
+			t.Fatalf("StackForGoID(%d) found no goroutine", id)
+		}
+		if !bytes.HasPrefix(stack, []byte(fmt.Sprintf("goroutine %d [", id))) {
+			t.Fatalf("expected the stack of goroutine %d, got %q", id, stack)
+		}
+		if bytes.HasSuffix(stack, []byte("\n")) || bytes.Contains(stack, []byte("\n\n")) {
+			t.Errorf("expected a single block without a trailing newline, got %q", stack)
+		}
+		if bytes.Contains(stack, []byte("goid.blockForStackTest(")) {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("expected the stack to contain blockForStackTest, got %q", stack)
+		}
+		runtime.Gosched()
+	}
+
+	if stack, ok := StackForGoID(1 << 62); ok {
+		t.Errorf("expected no goroutine with a huge id, got %q", stack)
+	}
+}
+
+func blockOnChanForSnapshotTest(ch chan struct{}) {
+	<-ch
+}
+
+func blockOnSelectForSnapshotTest(ch chan struct{}) {
+	select {
+	case <-ch:
+	case <-ch:
+	}
+}
+
+func blockOnMutexForSnapshotTest(mu *sync.Mutex) {
+	mu.Lock()
+	mu.Unlock()
+}
+
+func TestSnapshot(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	mu.Lock()
+	ids := make(chan GoID)
+	spawn := func(block func()) GoID {
+		go func() {
+			ids <- GetGoID()
+			block()
+		}()
+		return <-ids
+	}
+	self := GetGoID()
+	expected := map[GoID]GoroutineInfo{}
+	id := spawn(func() { blockOnChanForSnapshotTest(release) })
+	expected[id] = GoroutineInfo{ID: id, State: "chan receive",
+		Function: "github.com/observeinc/goid.blockOnChanForSnapshotTest", Parent: self}
+	id = spawn(func() { blockOnSelectForSnapshotTest(release) })
+	expected[id] = GoroutineInfo{ID: id, State: "select",
+		Function: "github.com/observeinc/goid.blockOnSelectForSnapshotTest", Parent: self}
+	id = spawn(func() { blockOnMutexForSnapshotTest(&mu) })
+	expected[id] = GoroutineInfo{ID: id, State: "sync.Mutex.Lock", Parent: self}
+	defer func() {
+		close(release)
+		mu.Unlock()
+	}()
+
+	// Wait for the goroutines to block
+	for try := 0; ; try++ {
+		infos, err := Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot() failed: %v", err)
+		}
+		var mismatch string
+		found := 0
+		for _, info := range infos {
+			if info.Stack != "" {
+				t.Fatalf("expected no stack, got %q", info.Stack)
+			}
+			if info.ID == GetGoID() && info.State != "running" {
+				t.Errorf("expected the current goroutine to be running, got %+v", info)
+			}
+			want, ok := expected[info.ID]
+			if !ok {
+				continue
+			}
+			found++
+			// The topmost frame of a goroutine blocked on a mutex is in
+			// package sync or runtime
+			if want.Function == "" {
+				want.Function = info.Function
+			}
+			if info != want {
+				mismatch = fmt.Sprintf("got %+v, expected %+v", info, want)
+			}
+		}
+		if found != len(expected) {
+			t.Fatalf("expected %d blocked goroutines, found %d", len(expected), found)
+		}
+		if mismatch == "" {
+			break
+		}
+		if try == 1000 {
+			t.Fatalf("%s", mismatch)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestSnapshotByState(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	mu.Lock()
+	ids := make(chan GoID)
+	spawn := func(block func()) GoID {
+		go func() {
+			ids <- GetGoID()
+			block()
+		}()
+		return <-ids
+	}
+	onChan := spawn(func() { <-release })
+	onMutex := spawn(func() {
+		mu.Lock()
+		mu.Unlock()
+	})
+	defer func() {
+		close(release)
+		mu.Unlock()
+	}()
+
+	// Wait for the goroutines to block
+	for try := 0; ; try++ {
+		infos, err := SnapshotByState("chan receive")
+		if err != nil {
+			t.Fatalf("SnapshotByState() failed: %v", err)
+		}
+		found := false
+		for _, info := range infos {
+			if !strings.HasPrefix(info.State, "chan receive") {
+				t.Errorf("unexpected state %q", info.State)
+			}
+			if info.ID == onMutex {
+				t.Errorf("goroutine %d blocked on a mutex was returned", onMutex)
+			}
+			if info.ID == onChan {
+				found = true
+			}
+		}
+		if found {
+			break
+		}
+		if try == 1000 {
+			t.Fatalf("goroutine %d blocked on a channel not found in %+v", onChan, infos)
+		}
+		runtime.Gosched()
+	}
+
+	if infos, err := SnapshotByState("no such state"); err != nil || len(infos) != 0 {
+		t.Errorf("SnapshotByState() of an unknown state = %+v, %v", infos, err)
+	}
+}
+
+func TestListGoroutines(t *testing.T) {
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		ids <- GetGoID()
+		<-release
+	}()
+	blocked := <-ids
+
+	// The blocked goroutine may take a moment to park
+	var states map[GoID]string
+	for i := 0; i < 1000 && states[blocked] != "chan receive"; i++ {
+		runtime.Gosched()
+		infos, err := ListGoroutines()
+		if err != nil {
+			t.Fatalf("ListGoroutines failed: %v", err)
+		}
+		states = make(map[GoID]string, len(infos))
+		for _, info := range infos {
+			states[info.ID] = info.State
+		}
+	}
+	if state := states[GetGoID()]; state != "running" {
+		t.Errorf("expected the current goroutine to be running, got %q", state)
+	}
+	if state := states[blocked]; state != "chan receive" {
+		t.Errorf("expected goroutine %d to be in chan receive, got %q", blocked, state)
+	}
+
+	// let parsing fail
+	fakeGoroutinePrefix(t)
+	if _, err := ListGoroutines(); !errors.Is(err, ErrDumpUnparsable) {
+		t.Errorf("expected ErrDumpUnparsable, got %v", err)
+	}
+}
+
+func TestGoIDRange(t *testing.T) {
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 5; i++ {
+		go func() {
+			ids <- GetGoID()
+			<-release
+		}()
+	}
+	live := map[GoID]bool{GetGoID(): true}
+	for i := 0; i < 5; i++ {
+		live[<-ids] = true
+	}
+
+	min, max, err := GoIDRange()
+	if err != nil {
+		t.Fatalf("GoIDRange failed: %v", err)
+	}
+	if min <= 0 || min > max {
+		t.Fatalf("GoIDRange() = %d, %d; expected 0 < min <= max", min, max)
+	}
+	for id := range live {
+		if id < min || id > max {
+			t.Errorf("live goroutine %d outside of [%d, %d]", id, min, max)
+		}
+	}
+	if alive, err := IsAlive(min); err != nil || !alive {
+		t.Errorf("goroutine %d at the bottom of the range is not alive", min)
+	}
+}
+
+func TestAllGoIDs(t *testing.T) {
+	const n = 100
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < n; i++ {
+		go func() {
+			ids <- GetGoID()
+			<-release
+		}()
+	}
+	live := map[GoID]bool{GetGoID(): true}
+	for i := 0; i < n; i++ {
+		live[<-ids] = true
+	}
+
+	all := AllGoIDs()
+	if all == nil {
+		t.Fatalf("AllGoIDs failed")
+	}
+	if all[0] != GetGoID() {
+		t.Errorf("expected the current goroutine %d first, got %d", GetGoID(), all[0])
+	}
+	seen := make(map[GoID]bool, len(all))
+	for _, id := range all {
+		if seen[id] {
+			t.Errorf("duplicate id %d", id)
+		}
+		seen[id] = true
+	}
+	for id := range live {
+		if !seen[id] {
+			t.Errorf("live goroutine %d missing", id)
+		}
+	}
+}
+
+// syntheticDump returns a stack dump of n goroutines in various states
+func syntheticDump(n int) []byte {
+	states := []string{"running", "chan receive", "select", "IO wait, 5 minutes",
+		"sync.Mutex.Lock", "semacquire", "sleep"}
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "goroutine %d [%s]:\n", i+1, states[i%len(states)])
+		for depth := 0; depth < 5; depth++ {
+			fmt.Fprintf(&b, "main.worker%d(0xc000010000, 0x%x)\n\t/src/main.go:%d +0x%x\n",
+				depth, i, 10+depth, 0x20+depth)
+		}
+		b.WriteString("created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d\n")
+	}
+	return b.Bytes()
+}
+
+func TestParseGoroutines(t *testing.T) {
+	dump := syntheticDump(100)
+	infos, ok := parseGoroutines(dump)
+	if !ok || len(infos) != 100 {
+		t.Fatalf("expected 100 goroutines, got %d, %v", len(infos), ok)
+	}
+
+	// Parsing block by block gives the same result
+	var i int
+	forEachGoroutine(dump, func(id GoID, block []byte) bool {
+		if expected := newGoroutineInfo(id, block); infos[i] != expected {
+			t.Errorf("goroutine %d: got %+v, expected %+v", i, infos[i], expected)
+		}
+		i++
+		return true
+	})
+	if infos[3].ID != 4 || infos[3].State != "IO wait" || infos[3].Parent != 1 {
+		t.Errorf("unexpected goroutine %+v", infos[3])
+	}
+}
+
+func BenchmarkParseDump(b *testing.B) {
+	dump := syntheticDump(10000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(dump)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := parseGoroutines(dump); !ok {
+			b.Fatal("parseGoroutines failed")
+		}
+	}
+}
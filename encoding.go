@@ -0,0 +1,114 @@
+package goid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Label returns id in the "goroutine 4711" form used by runtime.Stack and panic
+// dumps, so that log lines are greppable against real stack traces. It is not
+// named String, to keep fmt printing a GoID as a bare integer.
+func (id GoID) Label() string {
+	return "goroutine " + strconv.FormatInt(int64(id), 10)
+}
+
+// AppendDecimal appends the decimal representation of id to b, with a leading
+// '-' if negative, and returns the extended buffer. It doesn't allocate if b
+// has room, which suits loggers formatting ids into reused buffers.
+func (id GoID) AppendDecimal(b []byte) []byte {
+	return strconv.AppendInt(b, int64(id), 10)
+}
+
+// Base36 returns the lowercase base36 encoding of id, a compact form for
+// correlation ids in URLs or headers. Zero is encoded as "0", and negative ids,
+// which never belong to a live goroutine, are encoded with a leading '-'.
+func (id GoID) Base36() string {
+	return strconv.FormatInt(int64(id), 36)
+}
+
+// ParseBase36 parses a goroutine id encoded by GoID.Base36. Letters are
+// accepted in either case.
+func ParseBase36(s string) (GoID, error) {
+	id, err := strconv.ParseInt(s, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("goid: invalid base36 goroutine id %q: %w", s, err)
+	}
+	return GoID(id), nil
+}
+
+// MarshalJSON encodes id as a JSON number
+func (id GoID) MarshalJSON() ([]byte, error) {
+	return id.AppendDecimal(nil), nil
+}
+
+// UnmarshalJSON decodes id from a JSON number or from a string holding a
+// decimal number, as emitted by systems which avoid JavaScript's 53-bit
+// integers. A JSON null sets id to 0, which is never a valid goroutine id.
+func (id *GoID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*id = 0
+		return nil
+	}
+	s := string(data)
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return fmt.Errorf("goid: invalid JSON goroutine id %s: %w", data, err)
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("goid: invalid JSON goroutine id %s: %w", data, err)
+	}
+	*id = GoID(v)
+	return nil
+}
+
+// MarshalText encodes id as decimal digits, for use as map keys and in
+// text-based formats
+func (id GoID) MarshalText() ([]byte, error) {
+	return id.AppendDecimal(nil), nil
+}
+
+// UnmarshalText decodes id from decimal digits, as encoded by MarshalText.
+// Anything else, including surrounding whitespace or a '+' sign, is an error.
+func (id *GoID) UnmarshalText(text []byte) error {
+	if len(text) > 0 && text[0] == '+' {
+		return fmt.Errorf("goid: invalid goroutine id %q: %w", text, strconv.ErrSyntax)
+	}
+	v, err := strconv.ParseInt(string(text), 10, 64)
+	if err != nil {
+		return fmt.Errorf("goid: invalid goroutine id %q: %w", text, err)
+	}
+	*id = GoID(v)
+	return nil
+}
+
+// binarySize is the size of the binary encoding of a GoID
+const binarySize = 8
+
+// MarshalBinary encodes id as 8 bytes, big-endian
+func (id GoID) MarshalBinary() ([]byte, error) {
+	return id.AppendBinary(make([]byte, 0, binarySize))
+}
+
+// AppendBinary appends the encoding of MarshalBinary to b, so that encoders
+// can reuse a buffer
+func (id GoID) AppendBinary(b []byte) ([]byte, error) {
+	var buf [binarySize]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(id))
+	return append(b, buf[:]...), nil
+}
+
+// UnmarshalBinary decodes id from 8 bytes, big-endian, as encoded by
+// MarshalBinary
+func (id *GoID) UnmarshalBinary(data []byte) error {
+	if len(data) != binarySize {
+		return fmt.Errorf("goid: invalid binary goroutine id of %d bytes, expected %d", len(data), binarySize)
+	}
+	*id = GoID(binary.BigEndian.Uint64(data))
+	return nil
+}
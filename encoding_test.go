@@ -0,0 +1,226 @@
+package goid
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestBase36(t *testing.T) {
+	tests := []struct {
+		id  GoID
+		b36 string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{35, "z"},
+		{36, "10"},
+		{4711, "3mv"},
+		{math.MaxInt64, "1y2p0ij32e8e7"},
+		{-1, "-1"},
+		{math.MinInt64, "-1y2p0ij32e8e8"},
+	}
+	for _, test := range tests {
+		if b36 := test.id.Base36(); b36 != test.b36 {
+			t.Errorf("GoID(%d).Base36() = %q, expected %q", test.id, b36, test.b36)
+		}
+		if id, err := ParseBase36(test.b36); err != nil || id != test.id {
+			t.Errorf("ParseBase36(%q) = %d, %v; expected %d, nil", test.b36, id, err, test.id)
+		}
+	}
+
+	for id := GoID(0); id < 100000; id += 7 {
+		if parsed, err := ParseBase36(id.Base36()); err != nil || parsed != id {
+			t.Fatalf("round trip of %d failed: %d, %v", id, parsed, err)
+		}
+	}
+
+	if id, err := ParseBase36("3MV"); err != nil || id != 4711 {
+		t.Errorf("ParseBase36(%q) = %d, %v; expected 4711, nil", "3MV", id, err)
+	}
+
+	for _, s := range []string{"", "-", "3 mv", "3mv!", "1y2p0ij32e8e8"} {
+		if _, err := ParseBase36(s); err == nil {
+			t.Errorf("ParseBase36(%q) succeeded, expected an error", s)
+		} else if !errors.Is(err, strconv.ErrSyntax) && !errors.Is(err, strconv.ErrRange) {
+			t.Errorf("ParseBase36(%q) returned unexpected error %v", s, err)
+		}
+	}
+}
+
+func TestAppendDecimal(t *testing.T) {
+	for _, id := range []GoID{0, 1, 4711, math.MaxInt64, -1, math.MinInt64} {
+		expected := "id=" + strconv.FormatInt(int64(id), 10)
+		if b := id.AppendDecimal([]byte("id=")); string(b) != expected {
+			t.Errorf("GoID(%d).AppendDecimal() = %q, expected %q", id, b, expected)
+		}
+	}
+
+	buf := make([]byte, 0, 32)
+	if allocs := testing.AllocsPerRun(100, func() {
+		buf = GoID(math.MaxInt64).AppendDecimal(buf[:0])
+	}); allocs != 0 {
+		t.Errorf("AppendDecimal() into a large enough buffer allocated %v times", allocs)
+	}
+}
+
+func BenchmarkAppendDecimal(b *testing.B) {
+	buf := make([]byte, 0, 32)
+	id := GoID(123456789)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = id.AppendDecimal(buf[:0])
+	}
+}
+
+// BenchmarkAppendInt is the baseline for BenchmarkAppendDecimal
+func BenchmarkAppendInt(b *testing.B) {
+	buf := make([]byte, 0, 32)
+	id := GoID(123456789)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = strconv.AppendInt(buf[:0], int64(id), 10)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type record struct {
+		ID GoID `json:"id"`
+	}
+
+	b, err := json.Marshal(record{4711})
+	if err != nil || string(b) != `{"id":4711}` {
+		t.Errorf("json.Marshal() = %s, %v; expected {\"id\":4711}, nil", b, err)
+	}
+
+	tests := []struct {
+		in string
+		id GoID
+	}{
+		{`{"id":4711}`, 4711},
+		{`{"id":"4711"}`, 4711},
+		{`{"id":-1}`, -1},
+		{`{"id":9223372036854775807}`, math.MaxInt64},
+		{`{"id":"9223372036854775807"}`, math.MaxInt64},
+		{`{"id":null}`, 0},
+		{`{}`, 0},
+	}
+	for _, test := range tests {
+		var r record
+		if err := json.Unmarshal([]byte(test.in), &r); err != nil || r.ID != test.id {
+			t.Errorf("json.Unmarshal(%s) = %d, %v; expected %d, nil", test.in, r.ID, err, test.id)
+		}
+	}
+
+	for _, in := range []string{
+		`{"id":9223372036854775808}`,
+		`{"id":"9223372036854775808"}`,
+		`{"id":47.11}`,
+		`{"id":"47.11"}`,
+		`{"id":"abc"}`,
+		`{"id":""}`,
+		`{"id":" 4711"}`,
+		`{"id":true}`,
+	} {
+		var r record
+		if err := json.Unmarshal([]byte(in), &r); err == nil {
+			t.Errorf("json.Unmarshal(%s) succeeded with %d, expected an error", in, r.ID)
+		}
+	}
+
+	r := record{4711}
+	if err := json.Unmarshal([]byte(`{"id":null}`), &r); err != nil || r.ID != 0 {
+		t.Errorf("json.Unmarshal() of null over 4711 = %d, %v; expected 0, nil", r.ID, err)
+	}
+
+	var id GoID
+	err = id.UnmarshalJSON([]byte(`"9223372036854775808"`))
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("UnmarshalJSON() of an overflowing id returned %v, expected ErrRange", err)
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, id := range []GoID{0, 1, 4711, -1, math.MaxInt64, math.MinInt64} {
+		text, err := id.MarshalText()
+		if err != nil || string(text) != strconv.FormatInt(int64(id), 10) {
+			t.Errorf("GoID(%d).MarshalText() = %q, %v", id, text, err)
+		}
+		var parsed GoID
+		if err := parsed.UnmarshalText(text); err != nil || parsed != id {
+			t.Errorf("UnmarshalText(%q) = %d, %v; expected %d, nil", text, parsed, err, id)
+		}
+	}
+
+	for _, text := range []string{"", " 4711", "4711 ", "4711\n", "+4711", "47x11", "0x10", "9223372036854775808"} {
+		id := GoID(42)
+		if err := id.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) succeeded with %d, expected an error", text, id)
+		} else if id != 42 {
+			t.Errorf("UnmarshalText(%q) failed but modified the id to %d", text, id)
+		}
+	}
+
+	// As map keys, which encoding/json encodes through MarshalText
+	b, err := json.Marshal(map[GoID]string{4711: "running"})
+	if err != nil || string(b) != `{"4711":"running"}` {
+		t.Errorf("json.Marshal() of a map = %s, %v", b, err)
+	}
+	var m map[GoID]string
+	if err := json.Unmarshal(b, &m); err != nil || m[4711] != "running" {
+		t.Errorf("json.Unmarshal() of a map = %v, %v", m, err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	var _ encoding.BinaryMarshaler = GoID(0)
+	var _ encoding.BinaryUnmarshaler = new(GoID)
+
+	tests := []struct {
+		id      GoID
+		encoded []byte
+	}{
+		{0, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{1, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{4711, []byte{0, 0, 0, 0, 0, 0, 0x12, 0x67}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{math.MaxInt64, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{math.MinInt64, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		b, err := test.id.MarshalBinary()
+		if err != nil || !bytes.Equal(b, test.encoded) {
+			t.Errorf("GoID(%d).MarshalBinary() = %x, %v; expected %x", test.id, b, err, test.encoded)
+		}
+		var parsed GoID
+		if err := parsed.UnmarshalBinary(b); err != nil || parsed != test.id {
+			t.Errorf("UnmarshalBinary(%x) = %d, %v; expected %d, nil", b, parsed, err, test.id)
+		}
+	}
+
+	// AppendBinary reuses the buffer
+	buf := make([]byte, 0, 16)
+	buf, _ = GoID(1).AppendBinary(buf)
+	buf, _ = GoID(2).AppendBinary(buf)
+	if len(buf) != 16 || cap(buf) != 16 || buf[7] != 1 || buf[15] != 2 {
+		t.Errorf("AppendBinary() twice = %x, expected both ids in the original buffer", buf)
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = GoID(4711).AppendBinary(buf[:0])
+	}); allocs != 0 {
+		t.Errorf("AppendBinary() into a large enough buffer allocated %v times", allocs)
+	}
+
+	for _, data := range [][]byte{nil, {}, {1}, make([]byte, 7), make([]byte, 9)} {
+		id := GoID(42)
+		if err := id.UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%x) succeeded with %d, expected an error", data, id)
+		} else if id != 42 {
+			t.Errorf("UnmarshalBinary(%x) failed but modified the id to %d", data, id)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package goid
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	exitMu       sync.Mutex
+	exitHooks    = make(map[GoID][]func()) // Callbacks by watched goroutine id
+	exitWatching bool                      // Whether watchExits is running
+
+	// How often watchExits checks whether watched goroutines are alive. It
+	// adapts to the churn of watched goroutines, within the cleanup bounds.
+	exitPollInterval    = 100 * time.Millisecond
+	exitMinPollInterval = 10 * time.Millisecond
+	exitMaxPollInterval = time.Second
+	exitNewHooks        int // Callbacks registered since the last poll
+)
+
+// exitChurnThreshold is the number of callbacks registered between two polls
+// of watchExits above which the poll interval shrinks
+const exitChurnThreshold = 16
+
+// SetCleanupBounds sets the bounds of the interval at which the background
+// goroutine of OnExit checks for exited goroutines. The interval halves, down
+// to min, while many goroutines register exit callbacks between checks, and
+// doubles, up to max, while none do. Panics unless 0 < min <= max.
+func SetCleanupBounds(min, max time.Duration) {
+	if min <= 0 || max < min {
+		panic("goid: invalid cleanup bounds")
+	}
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitMinPollInterval = min
+	exitMaxPollInterval = max
+	exitPollInterval = clampDuration(exitPollInterval, min, max)
+}
+
+// nextExitPollInterval adapts the poll interval of watchExits to the number of
+// callbacks registered since the last poll
+func nextExitPollInterval(interval time.Duration, newHooks int, min, max time.Duration) time.Duration {
+	switch {
+	case newHooks > exitChurnThreshold:
+		interval /= 2
+	case newHooks == 0:
+		interval *= 2
+	}
+	return clampDuration(interval, min, max)
+}
+
+// clampDuration returns d, constrained to [min, max]
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// OnExit registers fn to be called once the current goroutine has exited.
+//
+// There is no runtime hook for goroutine exit, so a background goroutine
+// periodically checks whether watched goroutines are still alive, and calls
+// their callbacks once they are gone. Hence fn runs on that background
+// goroutine, not on the exiting one, and possibly with a delay. The background
+// goroutine only runs while there are callbacks pending.
+//
+// Each check takes a dump of all goroutines with runtime.Stack, which stops
+// the world for a time proportional to the number of goroutines. While any
+// goroutine is watched, checks run every 10ms to 1s by default, depending on
+// how many goroutines get watched, see SetCleanupBounds. Values stored with
+// AutoLocal, PutMDC and the like are cleaned up this way too.
+func OnExit(fn func()) {
+	onExit(GetGoID(), fn)
+}
+
+// OnGoroutineExit registers fn to be called once the goroutine with the given
+// id has exited, like OnExit does for the current goroutine. If the goroutine
+// has already exited, fn is called on the next check. Like OnExit, this is
+// best-effort and timing-dependent: fn runs some time after the exit, on a
+// background goroutine. It costs periodic stop-the-world stack dumps while
+// any goroutine is watched, see OnExit. The runtime never frees the "g" of an
+// exited goroutine, so there is nothing for a finalizer to watch instead.
+func OnGoroutineExit(id GoID, fn func()) {
+	onExit(id, fn)
+}
+
+// onExit registers fn to be called once the goroutine with the given id has
+// exited
+func onExit(id GoID, fn func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks[id] = append(exitHooks[id], fn)
+	exitNewHooks++
+	if !exitWatching {
+		exitWatching = true
+		go watchExits()
+	}
+}
+
+// exitWatch registers at most one exit hook per goroutine, for stores which
+// delete the values of exited goroutines. Clearing a value doesn't unwatch the
+// goroutine, so that a goroutine which clears and sets its value over and over
+// doesn't pile up hooks. The zero value is ready to use.
+type exitWatch struct {
+	watched sync.Map // GoIDs with an exit hook pending
+}
+
+// watch registers fn to be called once goroutine id has exited, unless it is
+// already watched
+func (w *exitWatch) watch(id GoID, fn func()) {
+	if _, loaded := w.watched.LoadOrStore(id, struct{}{}); !loaded {
+		onExit(id, func() {
+			w.watched.Delete(id)
+			fn()
+		})
+	}
+}
+
+// watchExits polls for watched goroutines which have exited and calls their
+// callbacks, until there are no callbacks left
+func watchExits() {
+	for {
+		exitMu.Lock()
+		interval := exitPollInterval
+		exitMu.Unlock()
+		time.Sleep(interval)
+
+		exitMu.Lock()
+		exitPollInterval = nextExitPollInterval(exitPollInterval, exitNewHooks,
+			exitMinPollInterval, exitMaxPollInterval)
+		exitNewHooks = 0
+		if len(exitHooks) == 0 {
+			exitWatching = false
+			exitMu.Unlock()
+			return
+		}
+		dead := make(map[GoID]bool, len(exitHooks))
+		for id := range exitHooks {
+			dead[id] = true
+		}
+		exitMu.Unlock()
+
+		var parsed bool
+		withDump(func(dump []byte) {
+			parsed = forEachGoroutine(dump, func(id GoID, _ []byte) bool {
+				delete(dead, id)
+				return true
+			})
+		})
+		if !parsed {
+			continue
+		}
+
+		for id := range dead {
+			exitMu.Lock()
+			hooks := exitHooks[id]
+			delete(exitHooks, id)
+			exitMu.Unlock()
+
+			for _, fn := range hooks {
+				fn()
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastExitPolling speeds up the exit watcher for the duration of a test
+func fastExitPolling(t *testing.T) {
+	t.Helper()
+	exitMu.Lock()
+	min, max := exitMinPollInterval, exitMaxPollInterval
+	exitMu.Unlock()
+	SetCleanupBounds(time.Millisecond, time.Millisecond)
+	t.Cleanup(func() {
+		SetCleanupBounds(min, max)
+	})
+}
+
+func TestOnExit(t *testing.T) {
+	fastExitPolling(t)
+
+	exited := make(chan GoID, 1)
+	registered := make(chan GoID)
+	release := make(chan struct{})
+	go func() {
+		id := GetGoID()
+		OnExit(func() {
+			exited <- id
+		})
+		registered <- id
+		<-release
+	}()
+	id := <-registered
+
+	select {
+	case <-exited:
+		t.Fatalf("OnExit callback ran before the goroutine exited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case gid := <-exited:
+		if gid != id {
+			t.Errorf("OnExit callback ran for goroutine %d, expected %d", gid, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnExit callback did not run after the goroutine exited")
+	}
+}
+
+func TestOnGoroutineExit(t *testing.T) {
+	fastExitPolling(t)
+
+	ids := make(chan GoID)
+	go func() {
+		ids <- GetGoID()
+	}()
+	id := <-ids
+	runtime.GC()
+
+	exited := make(chan struct{})
+	OnGoroutineExit(id, func() {
+		close(exited)
+	})
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnGoroutineExit callback did not run for exited goroutine %d", id)
+	}
+}
+
+func TestExitCleansGoroutineLocals(t *testing.T) {
+	fastExitPolling(t)
+
+	idCh := make(chan GoID)
+	go func() {
+		PutMDC("request_id", "r1")
+		SetGoroutineDeadline(time.Now().Add(time.Hour))
+		idCh <- GetGoID()
+	}()
+	id := <-idCh
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, hasMDC := mdcs.local.get(id)
+		_, hasDeadline := deadlines.local.get(id)
+		if !hasMDC && !hasDeadline {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine locals not cleaned after exit: MDC %v, deadline %v",
+				hasMDC, hasDeadline)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExitHooksDontPileUp(t *testing.T) {
+	var r Registry
+	hooks := make(chan int)
+	go func() {
+		// A long-lived worker which clears and sets its state over and over
+		for i := 0; i < 100; i++ {
+			ClearMDC()
+			PutMDC("task", "x")
+			SetGoroutineDeadline(time.Time{})
+			SetGoroutineDeadline(time.Now().Add(time.Hour))
+			SetRecoveryPolicy(RecoverSwallow)
+			SetRecoveryPolicy(RecoverLog)
+			r.Unregister()
+			r.Register("worker")
+		}
+		exitMu.Lock()
+		n := len(exitHooks[GetGoID()])
+		exitMu.Unlock()
+		hooks <- n
+	}()
+	if n := <-hooks; n != 4 {
+		t.Errorf("expected one exit hook per store, got %d", n)
+	}
+}
+
+func TestNextExitPollInterval(t *testing.T) {
+	min, max := 10*time.Millisecond, time.Second
+	tests := []struct {
+		interval time.Duration
+		newHooks int
+		expected time.Duration
+	}{
+		{100 * time.Millisecond, 1000, 50 * time.Millisecond},
+		{100 * time.Millisecond, exitChurnThreshold + 1, 50 * time.Millisecond},
+		{100 * time.Millisecond, exitChurnThreshold, 100 * time.Millisecond},
+		{100 * time.Millisecond, 1, 100 * time.Millisecond},
+		{100 * time.Millisecond, 0, 200 * time.Millisecond},
+		{15 * time.Millisecond, 1000, 10 * time.Millisecond},
+		{800 * time.Millisecond, 0, time.Second},
+		{time.Hour, 1, time.Second},
+	}
+	for _, test := range tests {
+		if interval := nextExitPollInterval(test.interval, test.newHooks, min, max); interval != test.expected {
+			t.Errorf("nextExitPollInterval(%v, %d) = %v, expected %v",
+				test.interval, test.newHooks, interval, test.expected)
+		}
+	}
+}
+
+func TestCleanupAdaptsToChurn(t *testing.T) {
+	exitMu.Lock()
+	min, max := exitMinPollInterval, exitMaxPollInterval
+	exitMu.Unlock()
+	defer SetCleanupBounds(min, max)
+
+	lo, hi := 2*time.Millisecond, 64*time.Millisecond
+	SetCleanupBounds(hi, hi)
+	SetCleanupBounds(lo, hi)
+
+	interval := func() time.Duration {
+		exitMu.Lock()
+		defer exitMu.Unlock()
+		return exitPollInterval
+	}
+	if d := interval(); d != hi {
+		t.Fatalf("expected interval to be clamped to %v, got %v", hi, d)
+	}
+
+	// Keep the cleanup running with a long-lived watched goroutine
+	registered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		OnExit(func() {})
+		close(registered)
+		<-release
+	}()
+	<-registered
+
+	// A burst of short-lived goroutines registering exit callbacks speeds
+	// up the cleanup, down to the lower bound
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			var burst sync.WaitGroup
+			for i := 0; i < 4*exitChurnThreshold; i++ {
+				burst.Add(1)
+				go func() {
+					defer burst.Done()
+					OnExit(func() {})
+				}()
+			}
+			burst.Wait()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	waitForInterval(t, interval, lo)
+	close(stop)
+	wg.Wait()
+
+	// Without churn it slows down again, up to the upper bound
+	waitForInterval(t, interval, hi)
+}
+
+// waitForInterval waits until interval() returns expected
+func waitForInterval(t *testing.T, interval func() time.Duration, expected time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for interval() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected interval to reach %v, got %v", expected, interval())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetCleanupBoundsInvalid(t *testing.T) {
+	for _, bounds := range [][2]time.Duration{{0, time.Second}, {time.Second, time.Millisecond}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("SetCleanupBounds(%v, %v) did not panic", bounds[0], bounds[1])
+				}
+			}()
+			SetCleanupBounds(bounds[0], bounds[1])
+		}()
+	}
+}
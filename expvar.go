@@ -0,0 +1,45 @@
+package goid
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// ExpvarName is the name under which PublishExpvar publishes its variable
+const ExpvarName = "goid"
+
+var (
+	publishOnce   sync.Once
+	countingCalls uint32 // Set once PublishExpvar was called
+	fastCalls     int64  // Number of GetGoID calls that took the fast path
+	slowCalls     int64  // Number of GetGoID calls that took the slow path
+)
+
+// PublishExpvar publishes an expvar.Var named ExpvarName, which holds
+// "fast_available", whether the fast path is available, "fast_calls" and
+// "slow_calls", how many times GetGoID took either path, and "offset", the
+// offset of the id in the "g" or -1. A binary which silently degraded to the
+// slow path, say after a Go upgrade, then stands out on dashboards. Calling
+// it more than once is a no-op.
+//
+// Calls are only counted from the first call to PublishExpvar on, which
+// slows GetGoID down by a couple of atomic operations. Until then, the hot
+// path is unaffected.
+func PublishExpvar() {
+	publishOnce.Do(func() {
+		atomic.StoreUint32(&countingCalls, 1)
+		atomic.StoreUint32(&fastPathReady, 0)
+		expvar.Publish(ExpvarName, expvar.Func(expvarValue))
+	})
+}
+
+// expvarValue returns the value of the variable published by PublishExpvar
+func expvarValue() interface{} {
+	return map[string]interface{}{
+		"fast_available": fastPathEnabled && FastGetGoIDAvailable(),
+		"fast_calls":     atomic.LoadInt64(&fastCalls),
+		"slow_calls":     atomic.LoadInt64(&slowCalls),
+		"offset":         DetectedOffset(),
+	}
+}
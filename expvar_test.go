@@ -0,0 +1,55 @@
+package goid
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar()
+	PublishExpvar() // Must not panic on a duplicate name
+	// Count again in case an earlier run stopped counting, and stop counting
+	// afterwards, so that benchmarks measure the hot path
+	atomic.StoreUint32(&countingCalls, 1)
+	atomic.StoreUint32(&fastPathReady, 0)
+	defer atomic.StoreUint32(&countingCalls, 0)
+
+	type value struct {
+		FastAvailable bool  `json:"fast_available"`
+		FastCalls     int64 `json:"fast_calls"`
+		SlowCalls     int64 `json:"slow_calls"`
+		Offset        int   `json:"offset"`
+	}
+	read := func() value {
+		v := expvar.Get(ExpvarName)
+		if v == nil {
+			t.Fatalf("expected %q to be published", ExpvarName)
+		}
+		var val value
+		if err := json.Unmarshal([]byte(v.String()), &val); err != nil {
+			t.Fatalf("failed to decode %s: %v", v.String(), err)
+		}
+		return val
+	}
+
+	before := read()
+	for i := 0; i < 5; i++ {
+		GetGoID()
+	}
+	after := read()
+
+	if calls := (after.FastCalls + after.SlowCalls) - (before.FastCalls + before.SlowCalls); calls < 5 {
+		t.Errorf("expected the counters to advance by at least 5, got %d", calls)
+	}
+	if after.FastAvailable != FastGetGoIDAvailable() {
+		t.Errorf("expected fast_available %t, got %t", FastGetGoIDAvailable(), after.FastAvailable)
+	}
+	if after.FastAvailable && after.FastCalls-before.FastCalls < 5 {
+		t.Errorf("expected the fast path to be counted, got %+v then %+v", before, after)
+	}
+	if after.Offset != DetectedOffset() {
+		t.Errorf("expected offset %d, got %d", DetectedOffset(), after.Offset)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !goid_safe
+
+package goid
+
+// fastGid extracts the goroutine id from the "g"
+func fastGid() GoID {
+	return gidFromG(getg(), gidOffset)
+}
@@ -0,0 +1,9 @@
+//go:build goid_safe
+
+package goid
+
+// fastGid takes the slow path, as the goid_safe build tag leaves out reads of
+// the "g", so that even GetGoIDUnsafe is safe
+func fastGid() GoID {
+	return slowGid()
+}
@@ -0,0 +1,7 @@
+//go:build gc && !goid_safe
+
+package goid
+
+// fastPathEnabled tells whether the fast path may be used at all, see the
+// goid_safe build tag
+const fastPathEnabled = true
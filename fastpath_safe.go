@@ -0,0 +1,13 @@
+//go:build goid_safe || !gc
+
+package goid
+
+// fastPathEnabled tells whether the fast path may be used at all. The
+// goid_safe build tag disables it for deployments which don't want any
+// pointer arithmetic into runtime internals: GetGoID then always parses
+// runtime.Stack, offset detection is never reached, and the code reading the
+// "g" is left out of the build, so that even GetGoIDUnsafe takes the slow path.
+//
+// It is disabled with gccgo as well, whose "g" has a layout of its own. Its
+// runtime.Stack emits the same "goroutine N [" header, so the slow path works.
+const fastPathEnabled = false
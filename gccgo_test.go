@@ -0,0 +1,17 @@
+//go:build gccgo
+
+package goid
+
+import "testing"
+
+// TestGccgo documents the behavior with gccgo: the assembly and the offset
+// detection are compiled out, and GetGoID parses the id from runtime.Stack
+func TestGccgo(t *testing.T) {
+	if FastGetGoIDAvailable() {
+		t.Errorf("FastGetGoIDAvailable() = true with gccgo, expected false")
+	}
+	if _, _, err := DetectionReport(); err == nil {
+		t.Errorf("expected DetectionReport() to report the fast path as disabled")
+	}
+	testGid(t, GetGoID)
+}
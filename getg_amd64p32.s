@@ -1,4 +1,6 @@
 // Copyright 2018 Huan Du. All rights reserved.
 // Licensed under the MIT license that can be found in the LICENSE file.
 
+//go:build gc && !goid_safe
+
 #include "getg_amd64.s"
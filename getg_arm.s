@@ -1,6 +1,8 @@
 // Copyright 2018 Huan Du. All rights reserved.
 // Licensed under the MIT license that can be found in the LICENSE file.
 
+//go:build gc && !goid_safe
+
 #include "go_asm.h"
 #include "textflag.h"
 
@@ -0,0 +1,9 @@
+//go:build gc && !goid_safe && (386 || amd64 || amd64p32 || arm || arm64)
+
+package goid
+
+// getg returns the "g", a control block that holds runtime information about
+// the current goroutine. Implemented in Assembly.
+//
+//go:noescape
+func getg() *g
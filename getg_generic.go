@@ -0,0 +1,10 @@
+//go:build goid_safe || !gc || !(386 || amd64 || amd64p32 || arm || arm64)
+
+package goid
+
+// getg returns nil where there is no assembly to get the "g", such as with
+// gccgo, on wasm or on other architectures, or with the goid_safe build tag.
+// Offset detection then fails, so GetGoID always takes the slow path.
+func getg() *g {
+	return nil
+}
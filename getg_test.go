@@ -0,0 +1,48 @@
+//go:build gc && !goid_safe && (amd64 || arm64 || 386 || arm)
+
+package goid
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGetg(t *testing.T) {
+	// Keep the goroutines alive, as the "g" of an exited goroutine is reused
+	const n = 100
+	gs := make(chan *g, n)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			gs <- getg()
+			<-release
+		}()
+	}
+	defer wg.Wait()
+	defer close(release)
+
+	self := getg()
+	if self == nil {
+		t.Fatalf("getg() returned nil")
+	}
+	seen := map[*g]bool{self: true}
+	for i := 0; i < n; i++ {
+		g := <-gs
+		if g == nil {
+			t.Fatalf("getg() returned nil")
+		}
+		if seen[g] {
+			t.Errorf("getg() returned %p for two live goroutines", g)
+		}
+		seen[g] = true
+	}
+	if getg() != self {
+		t.Errorf("getg() changed within a goroutine")
+	}
+	if !FastGetGoIDAvailable() {
+		t.Errorf("fast path not available on an architecture with assembly getg")
+	}
+}
@@ -1,35 +1,344 @@
+// Package goid gets the id of the current goroutine, and builds goroutine
+// local facilities on top of it.
+//
+// Goroutine ids are always positive in practice, and never reused within a
+// process. The zero GoID means that the id is unknown or unavailable, see
+// GoID.Valid.
+//
+// The runtime hands out ids from a 64-bit counter, so an id is not reused
+// once its goroutine exits. What the runtime does reuse is the "g", its
+// control block: an exited goroutine's "g" goes to a free list and backs a
+// later goroutine, under a new id. State keyed by GoID thus never leaks into
+// an unrelated goroutine, but it does leak memory unless it is deleted once
+// the goroutine exits, see AutoLocal and OnExit.
 package goid
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
-// GoID is a goroutine id, a 64-bit integer that identifies a goroutine
+// GoID is a goroutine id, a 64-bit integer that identifies a goroutine. The
+// zero value means unknown or unavailable.
+//
+// Prefer GoID.Int64 and FromInt64 over raw conversions when interfacing with
+// APIs which take an int64, so that conversions stand out.
 type GoID int64
 
+// Int64 returns id as an int64
+func (id GoID) Int64() int64 {
+	return int64(id)
+}
+
+// FromInt64 returns v as a GoID, see GoID.Int64
+func FromInt64(v int64) GoID {
+	return GoID(v)
+}
+
+// Compare returns -1 if id is less than other, 0 if they are equal and +1 if
+// id is greater, which also suits slices.SortFunc:
+//
+//	slices.SortFunc(ids, GoID.Compare)
+func (id GoID) Compare(other GoID) int {
+	switch {
+	case id < other:
+		return -1
+	case id > other:
+		return 1
+	}
+	return 0
+}
+
+// SortGoIDs sorts ids in ascending order, e.g. to make the output of AllGoIDs
+// deterministic
+func SortGoIDs(ids []GoID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+}
+
+// Valid tells if id may identify a goroutine, as ids are always positive
+func (id GoID) Valid() bool {
+	return id > 0
+}
+
+// IsZero tells if id is zero, which GetGoID returns when the id can't be
+// determined
+func (id GoID) IsZero() bool {
+	return id == 0
+}
+
 // GetGoID gets the current goroutine id
+//
+// It is safe to call from goroutines handling signals delivered by os/signal,
+// which are ordinary goroutines. Go code never runs inside the actual OS
+// signal handler. The fast path only reads the "g" of the current goroutine.
+// The slow path calls runtime.Stack, which is fine in any goroutine but
+// would not be async-signal-safe in the C sense.
+//
+// When Go is built with -buildmode=c-shared or c-archive and called from
+// threads which the Go runtime did not create, the runtime runs the call on a
+// regular "g" with an id of its own, so both paths keep working.
+//
+// The same holds for cgo callbacks. A callback on the thread of a cgo call
+// runs on the goroutine which made the call, and returns its id. A callback
+// on a thread created in C runs on a "g" which the runtime sets up for such
+// threads, whose id is stable for the duration of the callback, but may
+// differ between callbacks.
+//
+// GetGoID returns 0 if the id can't be determined, see GetGoIDErr.
 func GetGoID() GoID {
-	if FastGetGoIDAvailable() {
+	if fastPathEnabled && atomic.LoadUint32(&fastPathReady) != 0 {
 		return fastGid()
 	}
-	return slowGid()
+	id, _ := getGoIDErr()
+	return id
+}
+
+// GetGoIDUnsafe gets the current goroutine id straight from the fast path,
+// without checking that it is available.
+//
+// DANGER: this is only meant for the hottest loops of profilers and
+// schedulers, where the single branch of GetGoID measurably matters. It must
+// not be called unless FastGetGoIDAvailable returned true beforehand,
+// otherwise its behavior is undefined: it may return garbage or crash the
+// process. Prefer GetGoID everywhere else.
+func GetGoIDUnsafe() GoID {
+	return fastGid()
+}
+
+// GetGoIDSafe gets the current goroutine id like GetGoID, but guards the fast
+// path against faults with debug.SetPanicOnFault, as detection does, and falls
+// back to the slow path if reading the "g" faults. This only happens if the
+// detected offset is wrong in a way the validation missed, which should never
+// be the case, but some would rather pay for the guard than risk a crash.
+//
+// The guard costs two calls to debug.SetPanicOnFault and a deferred recover,
+// some tens of nanoseconds, on top of GetGoID.
+func GetGoIDSafe() (id GoID) {
+	if !FastGetGoIDAvailable() {
+		return GetGoID()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			id = slowGid()
+		}
+	}()
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	return safeFastGid()
+}
+
+// safeFastGid is fastGid, as used by GetGoIDSafe
+var safeFastGid = fastGid
+
+// fastPathReady is set once the fast path is known to be available, and the
+// first GetGoID was recorded, so that GetGoID boils down to a single load and
+// a call to fastGid, and inlines. It stays unset while calls are counted, see
+// PublishExpvar.
+var fastPathReady uint32
+
+// armFastPath sets fastPathReady, unless the fast path got disabled or calls
+// got counted meanwhile. Those reset fastPathReady after updating their state,
+// so checking their state after setting it catches a store which raced with
+// them, and undoes it.
+func armFastPath() {
+	atomic.StoreUint32(&fastPathReady, 1)
+	if atomic.LoadUint32(&fastPathDisabled) != 0 || atomic.LoadUint32(&countingCalls) != 0 {
+		atomic.StoreUint32(&fastPathReady, 0)
+	}
+}
+
+// ErrGoIDUnavailable is returned by GetGoIDErr when the goroutine id can't be
+// determined
+var ErrGoIDUnavailable = errors.New("goid: goroutine id unavailable")
+
+// GetGoIDErr gets the current goroutine id, like GetGoID, but returns an error
+// wrapping ErrGoIDUnavailable instead of 0 if the id can't be determined. This
+// only happens when offset detection failed, so the fast path is unavailable,
+// and the slow path also failed to parse the id from the stack header. The
+// error tells the header, to help track down the failure.
+func GetGoIDErr() (GoID, error) {
+	if fastPathEnabled && atomic.LoadUint32(&fastPathReady) != 0 {
+		return fastGid(), nil
+	}
+	return getGoIDErr()
+}
+
+// getGoIDErr is GetGoIDErr, before fastPathReady is set
+func getGoIDErr() (GoID, error) {
+	if FastGetGoIDAvailable() {
+		if atomic.LoadUint32(&firstGetGoIDDone) == 0 {
+			firstGetGoID(true)
+		}
+		if atomic.LoadUint32(&countingCalls) != 0 {
+			atomic.AddInt64(&fastCalls, 1)
+		} else {
+			armFastPath()
+		}
+		return fastGid(), nil
+	}
+	if atomic.LoadUint32(&firstGetGoIDDone) == 0 {
+		firstGetGoID(false)
+	}
+	if atomic.LoadUint32(&countingCalls) != 0 {
+		atomic.AddInt64(&slowCalls, 1)
+	}
+	if id := slowGid(); id != 0 {
+		return id, nil
+	}
+	return 0, slowGidError()
+}
+
+// MustGetGoID gets the current goroutine id like GetGoIDErr, but panics if the
+// id can't be determined, telling which paths failed
+func MustGetGoID() GoID {
+	id, err := GetGoIDErr()
+	if err != nil {
+		panic(fmt.Errorf("goid: MustGetGoID (fast path available: %t, slow path failed: %t): %w",
+			FastGetGoIDAvailable(), slowGid() == 0, err))
+	}
+	return id
+}
+
+// slowGidError describes why slowGid failed, assuming offset detection failed
+// as well
+func slowGidError() error {
+	buf := [64]byte{}
+	header := buf[:runtime.Stack(buf[:], false)]
+	if end := bytes.IndexByte(header, '\n'); end >= 0 {
+		header = header[:end]
+	}
+	return fmt.Errorf("%w: offset of the id in the \"g\" not found, "+
+		"and failed to parse stack header %q", ErrGoIDUnavailable, header)
+}
+
+// CallerGoID gets the goroutine id of the caller skip frames up the stack,
+// analogous to runtime.Caller. Since a goroutine id never changes across the
+// frames of one goroutine, this is always the current goroutine id: wrappers
+// running synchronously in between can never observe a different goroutine.
+// It exists for symmetry with runtime.Caller.
+func CallerGoID(skip int) GoID {
+	return GetGoID()
+}
+
+// mainGoID is the id of the main goroutine. The runtime creates the goroutine
+// running runtime.main, which runs package initialization and then main.main,
+// before any other, and hands out ids from a counter starting at 1.
+const mainGoID GoID = 1
+
+// IsMainGoroutine tells if the current goroutine is the main goroutine, the
+// one running package initialization and main.main. This relies on the main
+// goroutine having id 1, which has held in every release of the gc toolchain.
+// Tests run on goroutines of their own, except for TestMain.
+func IsMainGoroutine() bool {
+	return GetGoID() == mainGoID
+}
+
+var (
+	firstGetGoIDDone uint32 // Set once the first GetGoID has been recorded
+	firstGetGoIDMu   sync.Mutex
+	firstGetGoIDFast bool
+	firstGetGoIDHook func(usedFastPath bool)
+)
+
+// OnFirstGetGoID registers fn to be invoked exactly once, on the first call to
+// GetGoID, reporting whether that call used the fast path. If GetGoID has
+// already been called, fn is invoked right away. Only the most recently
+// registered hook is kept.
+func OnFirstGetGoID(fn func(usedFastPath bool)) {
+	firstGetGoIDMu.Lock()
+	if atomic.LoadUint32(&firstGetGoIDDone) == 0 {
+		firstGetGoIDHook = fn
+		firstGetGoIDMu.Unlock()
+		return
+	}
+	usedFastPath := firstGetGoIDFast
+	firstGetGoIDMu.Unlock()
+	fn(usedFastPath)
+}
+
+// firstGetGoID records the path taken by the first GetGoID and fires the hook
+// registered with OnFirstGetGoID, if any
+func firstGetGoID(usedFastPath bool) {
+	firstGetGoIDMu.Lock()
+	if atomic.LoadUint32(&firstGetGoIDDone) != 0 {
+		firstGetGoIDMu.Unlock()
+		return
+	}
+	firstGetGoIDFast = usedFastPath
+	hook := firstGetGoIDHook
+	firstGetGoIDHook = nil
+	atomic.StoreUint32(&firstGetGoIDDone, 1)
+	firstGetGoIDMu.Unlock()
+
+	if hook != nil {
+		hook(usedFastPath)
+	}
 }
 
 // FastGetGoIDAvailable tells if a fast way to get current goroutine id is
 // available. GetGoID will use a very slow path otherwise
+//
+// Offset detection runs on the first call to FastGetGoIDAvailable or GetGoID,
+// rather than when the package is initialized. It turns false for good if
+// the offset monitor catches the fast path disagreeing with the slow path,
+// see StartOffsetMonitor, and while the fast path is turned off through
+// SetFastPathEnabled.
 func FastGetGoIDAvailable() bool {
-	return gidOffset >= 0
+	gidOffsetOnce.Do(resolveGidOffset)
+	return gidOffset >= 0 && atomic.LoadUint32(&fastPathDisabled) == 0
+}
+
+// Reasons for the fast path to be disabled, as bits of fastPathDisabled
+const (
+	disabledByDrift = 1 << iota // See StartOffsetMonitor
+	disabledByUser              // See SetFastPathEnabled
+)
+
+// fastPathDisabled holds the reasons why the fast path is disabled, despite
+// detection having succeeded
+var fastPathDisabled uint32
+
+// setFastPathDisabled sets or clears reason in fastPathDisabled. Calls which
+// already checked fastPathReady may still complete on the fast path.
+func setFastPathDisabled(reason uint32, disabled bool) (wasDisabled bool) {
+	for {
+		old := atomic.LoadUint32(&fastPathDisabled)
+		new := old &^ reason
+		if disabled {
+			new |= reason
+		}
+		if atomic.CompareAndSwapUint32(&fastPathDisabled, old, new) {
+			atomic.StoreUint32(&fastPathReady, 0)
+			return old&reason != 0
+		}
+	}
 }
 
-// getg returns the "g", a control block that holds runtime information about
-// the current goroutine. Implemented in Assembly.
+// SetFastPathEnabled turns the fast path off or back on process-wide, and
+// returns whether it was on before, so that tests can exercise their code
+// against both paths:
 //
-//go:noescape
-func getg() *g
+//	defer goid.SetFastPathEnabled(goid.SetFastPathEnabled(false))
+//
+// While it is off, GetGoID and friends take the slow path, and
+// FastGetGoIDAvailable returns false. Turning it on doesn't make the fast
+// path available if it wasn't otherwise. It is safe for concurrent use.
+func SetFastPathEnabled(enabled bool) bool {
+	return !setFastPathDisabled(disabledByUser, !enabled)
+}
 
 // Just for type safety. The contents of the "g" are only known to package
 // runtime and may change between Go versions.
@@ -37,51 +346,217 @@ type g struct{}
 
 var (
 	goroutinePrefix = "goroutine "
-	gidOffset       = getGidOffset() // Runs once during package initialization
+	gidOffsetOnce   sync.Once
+	gidOffset       = -1 // Set by resolveGidOffset, through gidOffsetOnce
 )
 
+// resolveGidOffset runs offset detection. Detection spawns goroutines, so it
+// is deferred until the first GetGoID, instead of running during package
+// initialization.
+func resolveGidOffset() {
+	gidOffset = detectGidOffset()
+	if os.Getenv(debugEnv) == "1" {
+		printDebugLine(debugOutput)
+	}
+}
+
+const gidSize = (int)(unsafe.Sizeof(GoID(0)))
+
+// Detection efforts, see SetDetectionEffort
 const (
-	gidSize    = (int)(unsafe.Sizeof(GoID(0)))
-	gSize      = 256 // If this library ever breaks, try to up this constant
-	checkCount = 10  // Number of checks per candidate offset, by each voter
-	voterCount = 10
+	DetectionEffortLow    = 1
+	DetectionEffortMedium = 2 // The default
+	DetectionEffortHigh   = 3
+)
+
+var (
+	checkCount  = 10 // Number of checks per candidate offset, by each voter
+	voterCount  = 10
+	voterQuorum = 8 // Number of voters which must agree on an offset
+
+	confirmBursts    = 3  // Number of rounds of confirmGidOffset
+	confirmBurstSize = 64 // Goroutines spawned to advance ids between rounds
 )
 
+// SetDetectionEffort scales how many voters offset detection spawns, how many
+// checks each of them runs per candidate offset, and how long the elected
+// offset is confirmed, to one of the DetectionEffort levels. It must be called
+// before the first GetGoID to take effect, and panics on an unknown level.
+//
+// DetectionEffortLow spawns about a tenth of the goroutines of the default,
+// and takes about a sixth of the time, but a wrong offset is then more likely
+// to pass by chance. It is still validated against the slow path before use.
+// DetectionEffortHigh spawns about four times the goroutines of the default
+// and takes about four times as long, for a bit more confidence on unusual
+// platforms.
+func SetDetectionEffort(level int) {
+	switch level {
+	case DetectionEffortLow:
+		checkCount, voterCount, voterQuorum = 3, 4, 3
+		confirmBursts, confirmBurstSize = 1, 16
+	case DetectionEffortMedium:
+		checkCount, voterCount, voterQuorum = 10, 10, 8
+		confirmBursts, confirmBurstSize = 3, 64
+	case DetectionEffortHigh:
+		checkCount, voterCount, voterQuorum = 20, 20, 16
+		confirmBursts, confirmBurstSize = 6, 128
+	default:
+		panic(fmt.Sprintf("goid: unknown detection effort %d", level))
+	}
+}
+
+// The runtime stores the goroutine id in the "g" as an int64, and detection
+// reads a GoID at every gidSize bytes of the "g", as does fastGid at the
+// offset found. Were GoID of another size, both would read garbage, so these
+// fail to compile unless GoID is 8 bytes.
+var (
+	_ [gidSize - 8]struct{}
+	_ [8 - gidSize]struct{}
+)
+
+// DefaultScanRange is how many bytes of the "g" detection scans, unless
+// changed by SetScanRange
+const DefaultScanRange = 512
+
+// gSize is how many bytes of the "g" detection scans
+var gSize = DefaultScanRange
+
+// ErrOffsetNearScanLimit is returned by DetectionReport along with the offset
+// found, if the offset is close to the end of the scan range. Future Go
+// versions may move the goroutine id past the range, so it should grow, see
+// SetScanRange.
+var ErrOffsetNearScanLimit = errors.New("goid: offset found near the end of the scan range")
+
+// SetScanRange sets how many bytes of the "g" offset detection scans for the
+// goroutine id, and for the status, see GetGStatus. Raise it if a future Go
+// version moves these fields deeper into the "g". It must be called before
+// the first GetGoID to take effect, and panics if max is too small to hold a
+// goroutine id.
+func SetScanRange(max int) {
+	if max < gidSize {
+		panic("goid: scan range too small")
+	}
+	gSize = max
+}
+
+// nearScanLimit tells if offset is within the last eighth of the scan range
+func nearScanLimit(offset int) bool {
+	return offset >= gSize-gSize/8
+}
+
 // slowGid calls runtime.Stack and extracts the goroutine id from the
 // stacktrace
 func slowGid() GoID {
-	buf := [32]byte{}
+	return readGid(runtime.Stack)
+}
 
-	// Parse the 4707 out of "goroutine 4707 ["
-	str := strings.TrimPrefix(
-		string(buf[:runtime.Stack(buf[:], false)]),
-		goroutinePrefix,
-	)
+// gidBufPool holds buffers for readGid. runtime.Stack lets its buffer escape,
+// so a buffer on the stack would be moved to the heap on every call.
+var gidBufPool = sync.Pool{
+	New: func() interface{} {
+		return new([32]byte)
+	},
+}
 
-	if lastOffset := strings.IndexByte(str, ' '); lastOffset > 0 {
-		if id, err := strconv.ParseInt(str[:lastOffset], 10, gidSize*8); err == nil {
-			return GoID(id)
+// maxGidHeaderSize bounds how far readGid grows its buffer
+const maxGidHeaderSize = 1024
+
+// readGid extracts the goroutine id from the stacktrace written by stack. A
+// small buffer fits the "goroutine 4707 [" header for any int64 id, but if the
+// header fails to parse and stack filled the buffer, it may have been
+// truncated, so readGid retries with a larger buffer.
+func readGid(stack func(buf []byte, all bool) int) GoID {
+	bufp := gidBufPool.Get().(*[32]byte)
+	defer gidBufPool.Put(bufp)
+	b := bufp[:]
+	for {
+		n := stack(b, false)
+		id := parseGid(b[:n])
+		if id != 0 || n < len(b) || len(b) >= maxGidHeaderSize {
+			return id
+		}
+		b = make([]byte, 2*len(b))
+	}
+}
+
+// parseGid extracts the goroutine id from a "goroutine 4707 [" stack header.
+// To tolerate minor format changes, it takes the first run of digits following
+// the "goroutine" keyword on the header line, and does not depend on exact
+// spacing or on what follows the digits. Returns 0 if no id could be parsed.
+//
+// It works on the bytes directly, so that slowGid doesn't allocate.
+func parseGid(b []byte) GoID {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	keyword := strings.TrimSpace(goroutinePrefix)
+	if keyword == "" || len(b) < len(keyword) || string(b[:len(keyword)]) != keyword {
+		return 0
+	}
+	b = b[len(keyword):]
+
+	// Skip to the digits, but not past the header
+	for len(b) > 0 && !isDigit(b[0]) {
+		if b[0] == '\n' || b[0] == '[' {
+			return 0
+		}
+		b = b[1:]
+	}
+
+	// The digits must be terminated, or they may have been truncated
+	var id GoID
+	for i, c := range b {
+		if !isDigit(c) {
+			if i == 0 {
+				return 0
+			}
+			return id
+		}
+		d := GoID(c - '0')
+		if id > (1<<63-1-d)/10 {
+			return 0
 		}
+		id = id*10 + d
 	}
 	return 0
 }
 
-// fastGid extracts the goroutine id from the "g"
-func fastGid() GoID {
-	return gidFromG(getg(), gidOffset)
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
 }
 
-// gidFromG casts the value at `g + offset` to a GoID
-//
-//go:nocheckptr
-func gidFromG(g *g, offset int) GoID {
-	return *(*GoID)(unsafe.Pointer(uintptr(unsafe.Pointer(g)) + uintptr(offset)))
+// slowGidRetries is how many times detection retries slowGid when it fails,
+// which may happen transiently on busy systems
+const slowGidRetries = 3
+
+var (
+	detectSlowGid    = slowGid // slowGid, as used by detection
+	detectionRetries int64     // Number of times detection retried slowGid
+)
+
+// retryingSlowGid calls slowGid, retrying a few times if it fails, so that a
+// transient failure doesn't make detection reject a valid offset
+func retryingSlowGid() GoID {
+	gid := detectSlowGid()
+	for i := 0; gid == 0 && i < slowGidRetries; i++ {
+		atomic.AddInt64(&detectionRetries, 1)
+		runtime.Gosched()
+		gid = detectSlowGid()
+	}
+	return gid
+}
+
+// DetectionRetries returns how many times offset detection had to retry
+// parsing the goroutine id from the stack, as a measure of how flaky detection
+// is on the current system
+func DetectionRetries() int {
+	return int(atomic.LoadInt64(&detectionRetries))
 }
 
 // findGidOffset iterates from `getg() + startOffset` to `getg() + maxOffset`
 // and returns the first offset where the stored value matches slowGid()
 func findGidOffset(startOffset, maxOffset int) (offset int) {
-	currGid := slowGid()
+	currGid := retryingSlowGid()
 	g := getg()
 
 	// Handle segmentation faults in case we run past the "g"
@@ -111,7 +586,7 @@ func checkGidOffset(offset int) bool {
 
 	for i := 0; i < checkCount; i++ {
 		go func() {
-			gid := slowGid()
+			gid := retryingSlowGid()
 			g := getg()
 			defer func() {
 				if r := recover(); r != nil {
@@ -134,46 +609,335 @@ func checkGidOffset(offset int) bool {
 	return result
 }
 
+// VerifyGoIDOffset checks that the fast path agrees with the slow path in a
+// handful of new goroutines, and returns an error describing the first
+// mismatch, or that the fast path is unavailable. It is meant for test suites
+// to fail fast when a Go upgrade breaks offset detection, and is safe to call
+// repeatedly.
+func VerifyGoIDOffset() error {
+	if !fastPathEnabled || !FastGetGoIDAvailable() {
+		return errors.New("goid: fast path unavailable, offset detection failed")
+	}
+	type ids struct{ fast, slow GoID }
+	ret := make(chan ids, checkCount)
+	for i := 0; i < checkCount; i++ {
+		go func() {
+			ret <- ids{fastGid(), slowGid()}
+		}()
+	}
+
+	var err error
+	for i := 0; i < checkCount; i++ {
+		if r := <-ret; r.fast != r.slow && err == nil {
+			err = fmt.Errorf("goid: fast path read goroutine id %d at offset %d, "+
+				"but the stack says %d", r.fast, gidOffset, r.slow)
+		}
+	}
+	return err
+}
+
 // getGidOffset figures out the offset in the "g" where the goroutine id is
 // stored
 func getGidOffset() int {
+	offset, _, _ := voteGidOffsets()
+	return offset
+}
+
+// voteGidOffsets runs the vote of getGidOffset, and also returns the votes for
+// each candidate offset, and why no offset was elected
+func voteGidOffsets() (int, map[int]int, error) {
 	// Spawn a bunch of "voter" goroutines, each of which finds a set of
 	// candidate offsets which appear to contain goroutine ids according
 	// to checkGidOffset
 	ret := make(chan []int, voterCount)
+	voter := detectVoter
 	for i := 0; i < voterCount; i++ {
 		go func() {
-			var localCandidateOffsets []int
-			for offset := 0; offset < gSize; offset += gidSize {
-				offset = findGidOffset(offset, gSize)
-				if offset == -1 {
-					// No more candidate offsets past offset
-					break
-				}
-				if checkGidOffset(offset) {
-					localCandidateOffsets = append(localCandidateOffsets, offset)
-				}
-			}
-			ret <- localCandidateOffsets
+			ret <- voter()
 		}()
 	}
 
-	// Count the votes
+	// Count the votes, unless the voters time out. Those which still run
+	// are left to finish on their own, as ret is buffered.
+	var timeout <-chan time.Time
+	d := time.Duration(atomic.LoadInt64(&detectTimeout))
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 	globalCandidateOffsets := make(map[int]int)
 	for i := 0; i < voterCount; i++ {
-		for _, offset := range <-ret {
-			globalCandidateOffsets[offset]++
+		select {
+		case offsets := <-ret:
+			for _, offset := range offsets {
+				globalCandidateOffsets[offset]++
+			}
+		case <-timeout:
+			reportDetectTimeout(d)
+			return -1, globalCandidateOffsets, fmt.Errorf("goid: offset detection timed out after %v", d)
 		}
 	}
 
-	// Pick an offset which all voters agree on. It is overwhelmingly likely
-	// that it is truly a valid offset where "g" stores the goroutine id.
+	// Pick the lowest offset which a quorum of voters agree on, and which
+	// passes an extended confirmation. It is overwhelmingly likely that it is
+	// truly a valid offset where "g" stores the goroutine id. Requiring a
+	// quorum rather than unanimity keeps a single voter which was starved on a
+	// busy system from disabling the fast path.
+	var elected []int
 	for offset, votes := range globalCandidateOffsets {
-		if votes == voterCount {
-			return offset
+		if votes >= voterQuorum {
+			elected = append(elected, offset)
+		}
+	}
+	if len(elected) == 0 {
+		return -1, globalCandidateOffsets, fmt.Errorf(
+			"goid: no offset reached a quorum of %d out of %d votes", voterQuorum, voterCount)
+	}
+	sort.Ints(elected)
+	for _, offset := range elected {
+		if confirmGidOffset(offset) {
+			return offset, globalCandidateOffsets, nil
 		}
 	}
 
 	// No such offset found
-	return -1
+	return -1, globalCandidateOffsets, fmt.Errorf(
+		"goid: no offset out of %v passed the final check", elected)
+}
+
+// confirmCheck is checkGidOffset, as used by confirmGidOffset
+var confirmCheck = checkGidOffset
+
+// confirmGidOffset checks offset with checkGidOffset over a few rounds, and
+// spawns a burst of goroutines before each, so that the checks cover a wider
+// range of ids. A field which mirrored the id by coincidence when the voters
+// ran is unlikely to keep doing so.
+func confirmGidOffset(offset int) bool {
+	for round := 0; round < confirmBursts; round++ {
+		var wg sync.WaitGroup
+		wg.Add(confirmBurstSize)
+		for i := 0; i < confirmBurstSize; i++ {
+			go wg.Done()
+		}
+		wg.Wait()
+		if !confirmCheck(offset) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultDetectTimeout is how long offset detection may take, unless changed
+// by SetDetectTimeout
+const DefaultDetectTimeout = 500 * time.Millisecond
+
+var (
+	detectTimeout     = int64(DefaultDetectTimeout)
+	detectTimeoutMu   sync.Mutex
+	detectTimeoutHook func(timeout time.Duration) = logDetectTimeout
+)
+
+// SetDetectTimeout bounds how long offset detection may take. If it takes
+// longer, as when voters are starved on an overloaded system, detection gives
+// up and GetGoID takes the slow path. Zero disables the timeout. It must be
+// called before the first GetGoID to take effect.
+func SetDetectTimeout(d time.Duration) {
+	if d < 0 {
+		panic("goid: negative detect timeout")
+	}
+	atomic.StoreInt64(&detectTimeout, int64(d))
+}
+
+// OnDetectTimeout registers fn to be invoked when offset detection times out,
+// replacing the default hook, which logs a warning with the standard logger.
+// A nil fn disables reporting.
+func OnDetectTimeout(fn func(timeout time.Duration)) {
+	detectTimeoutMu.Lock()
+	detectTimeoutHook = fn
+	detectTimeoutMu.Unlock()
+}
+
+func logDetectTimeout(timeout time.Duration) {
+	log.Printf("goid: offset detection timed out after %v, falling back to the slow path", timeout)
+}
+
+func reportDetectTimeout(timeout time.Duration) {
+	detectTimeoutMu.Lock()
+	hook := detectTimeoutHook
+	detectTimeoutMu.Unlock()
+	if hook != nil {
+		hook(timeout)
+	}
+}
+
+// detectVoter is voteGidOffset, as used by detection
+var detectVoter = voteGidOffset
+
+// voteGidOffset returns the candidate offsets found by a single voter
+func voteGidOffset() []int {
+	var localCandidateOffsets []int
+	for offset := 0; offset < gSize; offset += gidSize {
+		offset = findGidOffset(offset, gSize)
+		if offset == -1 {
+			// No more candidate offsets past offset
+			break
+		}
+		if checkGidOffset(offset) {
+			localCandidateOffsets = append(localCandidateOffsets, offset)
+		}
+	}
+	return localCandidateOffsets
+}
+
+// ReinitAfterFork re-runs offset detection and resets the cached offsets and
+// fast path availability. It is only meant for the narrow case of a child
+// process where Go goroutines still function after a fork-like manipulation
+// of the process state, so that cached results may no longer hold. It must be
+// called before any other goroutine uses the package again.
+func ReinitAfterFork() {
+	atomic.StoreUint32(&fastPathReady, 0)
+	setFastPathDisabled(disabledByDrift, false)
+	gidOffsetOnce = sync.Once{}
+	gidOffsetOnce.Do(resolveGidOffset)
+	gStatusOnce = sync.Once{}
+	gStatusOffset = -1
+}
+
+var (
+	observedOffsetsMu sync.Mutex
+	observedOffsets   []int // Distinct offsets found by detection, in order
+)
+
+// offsetEnv names the environment variable which caches the offset found by
+// detection, see DetectedOffset
+const offsetEnv = "GOID_OFFSET"
+
+// DetectedOffset returns the offset of the goroutine id in the "g", or -1 if
+// detection failed. The offset only depends on the Go version, so it may be
+// fed back through the GOID_OFFSET environment variable to skip detection on
+// later runs. An offset from GOID_OFFSET is still validated before use, and
+// ignored if it turns out to be wrong.
+func DetectedOffset() int {
+	gidOffsetOnce.Do(resolveGidOffset)
+	return gidOffset
+}
+
+// envGidOffset returns the offset set through GOID_OFFSET, if it is valid for
+// self, the "g" of the current goroutine. The offset is ignored if self is nil,
+// as getg is where there is no assembly to get the "g".
+func envGidOffset(self *g) (int, bool) {
+	s, ok := os.LookupEnv(offsetEnv)
+	if !ok {
+		return -1, false
+	}
+	offset, err := strconv.Atoi(s)
+	if err != nil || offset < 0 || offset > gSize-gidSize || offset%gidSize != 0 {
+		return -1, false
+	}
+	if self == nil {
+		return -1, false
+	}
+	if gid := retryingSlowGid(); gid == 0 || gidFromG(self, offset) != gid {
+		return -1, false
+	}
+	return offset, checkGidOffset(offset)
+}
+
+// detectGidOffset runs getGidOffset, unless GOID_OFFSET holds a valid offset,
+// and records the resulting offset for OffsetStability
+func detectGidOffset() int {
+	if !fastPathEnabled {
+		detectionMu.Lock()
+		detection = detectionResult{-1, nil,
+			errors.New("goid: fast path disabled by the goid_safe build tag or gccgo")}
+		detectionMu.Unlock()
+		return -1
+	}
+	var candidates map[int]int
+	var err error
+	offset, ok := envGidOffset(getg())
+	if !ok {
+		offset, candidates, err = voteGidOffsets()
+		if known := checkKnownOffset(offset); known != offset {
+			offset, err = known, nil
+		}
+	}
+	recordGidOffset(offset)
+	if offset >= 0 && err == nil && nearScanLimit(offset) {
+		err = ErrOffsetNearScanLimit
+	}
+
+	detectionMu.Lock()
+	detection = detectionResult{offset, candidates, err}
+	detectionMu.Unlock()
+
+	switch {
+	case offset < 0:
+		logf("goid: offset detection failed, falling back to the slow path: %v", err)
+	case err != nil:
+		logf("goid: goroutine id found at offset %d of the \"g\": %v", offset, err)
+	default:
+		logf("goid: goroutine id found at offset %d of the \"g\"", offset)
+	}
+	return offset
+}
+
+type detectionResult struct {
+	offset     int
+	candidates map[int]int
+	err        error
+}
+
+var (
+	detectionMu sync.Mutex
+	detection   detectionResult // Result of the last detection
+)
+
+// DetectionReport returns the result of the last offset detection, running
+// detection first if it hasn't run yet: the offset found, or -1, the number of
+// votes for each candidate offset, and why no offset was found, if so. The
+// votes are nil if the offset came from GOID_OFFSET, see DetectedOffset. It
+// helps tell why the fast path is or isn't available on a given platform.
+//
+// If an offset was found close to the end of the scan range, err is
+// ErrOffsetNearScanLimit.
+func DetectionReport() (offset int, candidates map[int]int, err error) {
+	gidOffsetOnce.Do(resolveGidOffset)
+	detectionMu.Lock()
+	defer detectionMu.Unlock()
+	if detection.candidates != nil {
+		candidates = make(map[int]int, len(detection.candidates))
+		for o, votes := range detection.candidates {
+			candidates[o] = votes
+		}
+	}
+	return detection.offset, candidates, detection.err
+}
+
+// recordGidOffset remembers offset as observed, unless detection failed or
+// the offset was seen before
+func recordGidOffset(offset int) {
+	if offset < 0 {
+		return
+	}
+	observedOffsetsMu.Lock()
+	defer observedOffsetsMu.Unlock()
+	for _, o := range observedOffsets {
+		if o == offset {
+			return
+		}
+	}
+	observedOffsets = append(observedOffsets, offset)
+}
+
+// OffsetStability reports whether offset detection, across every time it ran
+// in this process, always settled on the same offset, along with the distinct
+// offsets observed. Failed detections are not counted. A changing offset
+// within one process means the fast path cannot be trusted.
+func OffsetStability() (stable bool, observed []int) {
+	observedOffsetsMu.Lock()
+	defer observedOffsetsMu.Unlock()
+	observed = append([]int(nil), observedOffsets...)
+	return len(observed) <= 1, observed
 }
@@ -4,13 +4,104 @@
 package goid
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"unsafe"
 )
 
+// Measured during package initialization, before anything calls GetGoID
+var initNumGoroutine, initProbeGoID = probeGoroutines()
+
+// initGoID is the id of the goroutine running package initialization, from the
+// slow path, so as not to run detection
+var initGoID = slowGid()
+
+// probeGoroutines returns the number of goroutines, and the id of a newly
+// spawned goroutine, which tells how many goroutines were spawned before
+func probeGoroutines() (int, GoID) {
+	n := runtime.NumGoroutine()
+	id := make(chan GoID)
+	go func() {
+		id <- slowGid()
+	}()
+	return n, <-id
+}
+
+func TestLazyDetection(t *testing.T) {
+	// Detection spawns voterCount voters, each spawning checkCount goroutines
+	// per candidate offset where getg works, which pushes the probe id past
+	// that many
+	if initNumGoroutine != 1 || initProbeGoID >= GoID(voterCount*checkCount) {
+		t.Errorf("expected no goroutines spawned during package initialization, "+
+			"got %d goroutines and probe goroutine id %d", initNumGoroutine, initProbeGoID)
+	}
+
+	before := runtime.NumGoroutine()
+	FastGetGoIDAvailable()
+	_, probe := probeGoroutines()
+	if probe < initProbeGoID+GoID(voterCount) {
+		t.Errorf("expected detection to have spawned goroutines by now, probe goroutine id %d", probe)
+	}
+	if after := runtime.NumGoroutine(); after > before+1 {
+		t.Errorf("detection left goroutines behind: %d before, %d after", before, after)
+	}
+}
+
+func TestCompareAndSort(t *testing.T) {
+	tests := []struct {
+		a, b     GoID
+		expected int
+	}{
+		{1, 2, -1}, {2, 1, 1}, {7, 7, 0}, {-1, 0, -1}, {math.MinInt64, math.MaxInt64, -1},
+	}
+	for _, test := range tests {
+		if c := test.a.Compare(test.b); c != test.expected {
+			t.Errorf("GoID(%d).Compare(%d) = %d, expected %d", test.a, test.b, c, test.expected)
+		}
+	}
+
+	ids := make([]GoID, 1000)
+	for i := range ids {
+		ids[i] = GoID(i/2 + 1) // With duplicates
+	}
+	rand.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+	SortGoIDs(ids)
+	for i := range ids {
+		if ids[i] != GoID(i/2+1) {
+			t.Fatalf("ids not sorted at %d: %v", i, ids[i])
+		}
+	}
+	SortGoIDs(nil)
+}
+
+func TestIsMainGoroutine(t *testing.T) {
+	if initGoID != mainGoID {
+		t.Errorf("expected package initialization to run on goroutine %d, got %d", mainGoID, initGoID)
+	}
+	if IsMainGoroutine() {
+		t.Errorf("expected the test goroutine not to be the main goroutine")
+	}
+	done := make(chan bool)
+	go func() {
+		done <- IsMainGoroutine()
+	}()
+	if <-done {
+		t.Errorf("expected a spawned goroutine not to be the main goroutine")
+	}
+}
+
 func TestTypeGoID(t *testing.T) {
 	var gid GoID = 4711
 	var gidIfc interface{} = gid
@@ -20,6 +111,11 @@ func TestTypeGoID(t *testing.T) {
 		t.Errorf("type assertion from GoID to int64 succeeded, should not")
 	}
 
+	// The runtime's goroutine id is an int64, which detection depends on
+	if size := unsafe.Sizeof(gid); size != 8 || gidSize != 8 {
+		t.Errorf("expected GoID to be 8 bytes, got %d", size)
+	}
+
 	// Make sure reflect recognizes type GoID as an int64. Many marshalling
 	// libraries will depend on that.
 	gidVal := reflect.ValueOf(gidIfc)
@@ -41,25 +137,406 @@ func TestTypeGoID(t *testing.T) {
 	if s := fmt.Sprintf("%d", gid); s != "4711" {
 		t.Errorf(`fmt.Sprintf("%%d", gid) printed %q`, s)
 	}
+
+	if gid.Int64() != 4711 || FromInt64(4711) != gid || FromInt64(gid.Int64()) != gid {
+		t.Errorf("Int64 and FromInt64 should round-trip, got %d and %d", gid.Int64(), FromInt64(4711))
+	}
+
+	if !gid.Valid() || !GetGoID().Valid() || GoID(0).Valid() || GoID(-1).Valid() {
+		t.Errorf("Valid() should hold for positive ids only")
+	}
+
+	// Label has the stack header form, without affecting fmt
+	if s := gid.Label(); s != "goroutine 4711" {
+		t.Errorf("gid.Label() returned %q", s)
+	}
+	if id := parseGid([]byte(GetGoID().Label() + " [running]:")); id != GetGoID() {
+		t.Errorf("parseGid() of Label() returned %d, expected %d", id, GetGoID())
+	}
 }
 
 func TestGetGidOffset(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
 	if getGidOffset() < 0 {
 		t.Fatalf("getGidOffset failed unexpectedly")
 	}
 
 	// let slowGid() fail
-	temp := goroutinePrefix
-	defer func() {
-		goroutinePrefix = temp
-	}()
-	goroutinePrefix = "fake "
+	fakeGoroutinePrefix(t)
 	if getGidOffset() >= 0 {
 		t.Fatalf("getGidOffset succeeded unexpectedly")
 	}
 }
 
+func TestSetDetectionEffort(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	defer SetDetectionEffort(DetectionEffortMedium)
+
+	for _, level := range []int{DetectionEffortLow, DetectionEffortHigh, DetectionEffortMedium} {
+		SetDetectionEffort(level)
+		offset, candidates, err := voteGidOffsets()
+		if offset != gidOffset || err != nil {
+			t.Errorf("voteGidOffsets() = %d, %v at effort %d; expected %d, nil", offset, err, level, gidOffset)
+		}
+		if votes := candidates[offset]; votes < voterQuorum || votes > voterCount {
+			t.Errorf("expected %d to %d votes at effort %d, got %v", voterQuorum, voterCount, level, candidates)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetDetectionEffort(0) did not panic")
+		}
+	}()
+	SetDetectionEffort(0)
+}
+
+func TestSetScanRange(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	defer func() {
+		SetScanRange(DefaultScanRange)
+		detectGidOffset()
+	}()
+
+	// Too small a range misses the offset
+	SetScanRange(gidOffset)
+	if offset := getGidOffset(); offset != -1 {
+		t.Errorf("getGidOffset() = %d with a scan range of %d, expected -1", offset, gidOffset)
+	}
+
+	// Just large enough finds it, but warns about it
+	SetScanRange(gidOffset + gidSize)
+	detectGidOffset()
+	if offset, _, err := DetectionReport(); offset != gidOffset || err != ErrOffsetNearScanLimit {
+		t.Errorf("DetectionReport() = %d, %v; expected %d, ErrOffsetNearScanLimit", offset, err, gidOffset)
+	}
+
+	SetScanRange(DefaultScanRange)
+	detectGidOffset()
+	if offset, _, err := DetectionReport(); offset != gidOffset || err != nil {
+		t.Errorf("DetectionReport() = %d, %v; expected %d, nil", offset, err, gidOffset)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetScanRange(0) did not panic")
+		}
+	}()
+	SetScanRange(0)
+}
+
+func TestGetGidOffsetQuorum(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	defer func() {
+		detectVoter = voteGidOffset
+	}()
+
+	// Voters which dissent, or vote for a bogus offset, must not keep
+	// detection from electing the valid one, nor be elected themselves
+	bogus := (gidOffset + gidSize) % gSize
+	var voters int64
+	detectVoter = func() []int {
+		switch atomic.AddInt64(&voters, 1) {
+		case 1:
+			return nil
+		case 2:
+			return []int{bogus}
+		default:
+			return voteGidOffset()
+		}
+	}
+	if offset := getGidOffset(); offset != gidOffset {
+		t.Errorf("getGidOffset() = %d with dissenting voters, expected %d", offset, gidOffset)
+	}
+
+	// Below the quorum, nothing is elected
+	voters = 0
+	detectVoter = func() []int {
+		if atomic.AddInt64(&voters, 1) <= int64(voterCount-voterQuorum+1) {
+			return nil
+		}
+		return voteGidOffset()
+	}
+	if offset := getGidOffset(); offset != -1 {
+		t.Errorf("getGidOffset() = %d without a quorum, expected -1", offset)
+	}
+
+	// An offset elected by a quorum must still pass the final check
+	detectVoter = func() []int {
+		return []int{bogus, gidOffset}
+	}
+	if offset := getGidOffset(); offset != gidOffset {
+		t.Errorf("getGidOffset() = %d with a unanimous bogus offset, expected %d", offset, gidOffset)
+	}
+}
+
+func TestConfirmGidOffset(t *testing.T) {
+	if !FastGetGoIDAvailable() || gidOffset < gidSize {
+		t.Skip("fast path not available")
+	}
+	defer func() {
+		detectVoter = voteGidOffset
+		confirmCheck = checkGidOffset
+	}()
+
+	// A decoy below the real offset passes the first check, as if it mirrored
+	// the id for a while, but not the later ones
+	decoy := gidOffset - gidSize
+	var decoyChecks int64
+	confirmCheck = func(offset int) bool {
+		if offset == decoy {
+			return atomic.AddInt64(&decoyChecks, 1) == 1
+		}
+		return checkGidOffset(offset)
+	}
+	detectVoter = func() []int {
+		return []int{gidOffset, decoy}
+	}
+	for i := 0; i < 3; i++ {
+		atomic.StoreInt64(&decoyChecks, 0)
+		if offset := getGidOffset(); offset != gidOffset {
+			t.Errorf("getGidOffset() = %d with a decoy at %d, expected %d", offset, decoy, gidOffset)
+		}
+		if n := atomic.LoadInt64(&decoyChecks); n < 2 {
+			t.Errorf("expected the decoy to be checked again after passing, got %d checks", n)
+		}
+	}
+
+	// Confirmation spawns goroutines, advancing the ids
+	before := slowGid()
+	if !confirmGidOffset(gidOffset) {
+		t.Errorf("confirmGidOffset(%d) failed for the real offset", gidOffset)
+	}
+	done := make(chan GoID)
+	go func() {
+		done <- slowGid()
+	}()
+	if after := <-done; after < before+GoID(confirmBursts*confirmBurstSize) {
+		t.Errorf("expected confirmation to advance ids past %d, got %d",
+			before+GoID(confirmBursts*confirmBurstSize), after)
+	}
+}
+
+func TestDetectTimeout(t *testing.T) {
+	defer func() {
+		detectVoter = voteGidOffset
+		SetDetectTimeout(DefaultDetectTimeout)
+		OnDetectTimeout(logDetectTimeout)
+	}()
+
+	var timeouts []time.Duration
+	OnDetectTimeout(func(timeout time.Duration) {
+		timeouts = append(timeouts, timeout)
+	})
+	release := make(chan struct{})
+	defer close(release)
+	detectVoter = func() []int {
+		<-release
+		return nil
+	}
+
+	SetDetectTimeout(10 * time.Millisecond)
+	start := time.Now()
+	if offset := getGidOffset(); offset != -1 {
+		t.Errorf("getGidOffset() = %d with starved voters, expected -1", offset)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("getGidOffset() took %v to time out", elapsed)
+	}
+	if len(timeouts) != 1 || timeouts[0] != 10*time.Millisecond {
+		t.Errorf("expected the hook to report a single timeout of 10ms, got %v", timeouts)
+	}
+
+	// Disabled, detection waits for the voters
+	SetDetectTimeout(0)
+	detectVoter = voteGidOffset
+	if offset := getGidOffset(); FastGetGoIDAvailable() && offset != gidOffset {
+		t.Errorf("getGidOffset() = %d without a timeout, expected %d", offset, gidOffset)
+	}
+}
+
+func TestGetGidOffsetRetries(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+
+	// Let the first few slowGid calls fail, but no more than a single
+	// caller can retry
+	var calls int64
+	defer func() {
+		detectSlowGid = slowGid
+	}()
+	detectSlowGid = func() GoID {
+		if atomic.AddInt64(&calls, 1) <= slowGidRetries {
+			return 0
+		}
+		return slowGid()
+	}
+
+	retries := DetectionRetries()
+	if offset := getGidOffset(); offset != gidOffset {
+		t.Errorf("getGidOffset() = %d with flaky slowGid, expected %d", offset, gidOffset)
+	}
+	if DetectionRetries() <= retries {
+		t.Errorf("expected DetectionRetries() to grow past %d, got %d", retries, DetectionRetries())
+	}
+}
+
+func TestReinitAfterFork(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	temp := DetectedOffset()
+	defer func() {
+		gidOffset = temp
+	}()
+
+	gidOffset = -1
+	if FastGetGoIDAvailable() {
+		t.Fatalf("fast path available after reset")
+	}
+	ReinitAfterFork()
+	if !FastGetGoIDAvailable() {
+		t.Fatalf("fast path not re-established by ReinitAfterFork")
+	}
+	if gidOffset != temp {
+		t.Errorf("ReinitAfterFork detected offset %d, expected %d", gidOffset, temp)
+	}
+	testGid(t, GetGoID)
+	if status, ok := GetGStatus(); !ok || status != GStatusRunning {
+		t.Errorf("GetGStatus() = %d, %v after ReinitAfterFork", status, ok)
+	}
+}
+
+func TestDetectedOffset(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	offset := DetectedOffset()
+	if offset != gidOffset || offset < 0 {
+		t.Fatalf("DetectedOffset() = %d, expected %d", offset, gidOffset)
+	}
+
+	t.Setenv(offsetEnv, strconv.Itoa(offset))
+	if o, ok := envGidOffset(getg()); !ok || o != offset {
+		t.Errorf("envGidOffset() = %d, %v; expected %d, true", o, ok, offset)
+	}
+	// Without a "g", as where getg returns nil, the offset can't be read
+	if o, ok := envGidOffset(nil); ok {
+		t.Errorf("envGidOffset(nil) accepted %s=%d as %d", offsetEnv, offset, o)
+	}
+	if o := detectGidOffset(); o != offset {
+		t.Errorf("detectGidOffset() = %d with a valid %s, expected %d", o, offsetEnv, offset)
+	}
+
+	for _, bad := range []string{"", "x", "-8", strconv.Itoa(offset + 1), strconv.Itoa(offset + gidSize), "4096"} {
+		t.Setenv(offsetEnv, bad)
+		if o, ok := envGidOffset(getg()); ok {
+			t.Errorf("envGidOffset() accepted %s=%q as %d", offsetEnv, bad, o)
+		}
+		if o := detectGidOffset(); o != offset {
+			t.Errorf("detectGidOffset() = %d with %s=%q, expected fallback to %d", o, offsetEnv, bad, offset)
+		}
+	}
+}
+
+func TestDetectionReport(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	expected := gidOffset
+	detectGidOffset()
+	offset, candidates, err := DetectionReport()
+	if offset != expected || err != nil {
+		t.Errorf("DetectionReport() = %d, %v; expected %d, nil", offset, err, expected)
+	}
+	if votes := candidates[expected]; votes < voterQuorum || votes > voterCount {
+		t.Errorf("expected a quorum of votes for offset %d, got %v", expected, candidates)
+	}
+
+	// The candidates are a copy
+	candidates[expected] = 0
+	if _, candidates, _ := DetectionReport(); candidates[expected] == 0 {
+		t.Errorf("modifying the candidates changed the report")
+	}
+
+	// Failed detection
+	t.Cleanup(func() {
+		detectGidOffset()
+	})
+	fakeGoroutinePrefix(t)
+	detectGidOffset()
+	offset, candidates, err = DetectionReport()
+	if offset != -1 || len(candidates) != 0 || err == nil || !strings.Contains(err.Error(), "quorum") {
+		t.Errorf("DetectionReport() = %d, %v, %v; expected -1, no candidates and a quorum error",
+			offset, candidates, err)
+	}
+}
+
+func TestOffsetStability(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	observedOffsetsMu.Lock()
+	temp := observedOffsets
+	observedOffsets = nil
+	observedOffsetsMu.Unlock()
+	defer func() {
+		observedOffsetsMu.Lock()
+		observedOffsets = temp
+		observedOffsetsMu.Unlock()
+	}()
+
+	offset := detectGidOffset()
+	detectGidOffset()
+	if stable, observed := OffsetStability(); !stable || len(observed) != 1 || observed[0] != offset {
+		t.Fatalf("OffsetStability() = %v, %v; expected true, [%d]", stable, observed, offset)
+	}
+
+	// Simulate a re-scan that settled on a different offset
+	recordGidOffset(offset + gidSize)
+	stable, observed := OffsetStability()
+	if stable {
+		t.Errorf("OffsetStability() reported stable after the offset changed")
+	}
+	if len(observed) != 2 || observed[0] != offset || observed[1] != offset+gidSize {
+		t.Errorf("expected observed offsets [%d %d], got %v", offset, offset+gidSize, observed)
+	}
+}
+
+func TestVerifyGoIDOffset(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		if err := VerifyGoIDOffset(); err == nil {
+			t.Errorf("VerifyGoIDOffset() succeeded without the fast path")
+		}
+		t.Skip("fast path not available")
+	}
+	for i := 0; i < 3; i++ {
+		if err := VerifyGoIDOffset(); err != nil {
+			t.Errorf("VerifyGoIDOffset() failed: %v", err)
+		}
+	}
+
+	// Let slowGid() fail, so the paths disagree
+	fakeGoroutinePrefix(t)
+	err := VerifyGoIDOffset()
+	if err == nil || !strings.Contains(err.Error(), "but the stack says 0") {
+		t.Errorf("VerifyGoIDOffset() = %v, expected a mismatch", err)
+	}
+}
+
 func TestFindGidOffset(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
 	if off := findGidOffset(10, 9); off >= 0 {
 		t.Errorf("expected findGidOffset(%d,%d) to find nothing, found offset %d", 10, 9, off)
 	}
@@ -82,6 +559,34 @@ func TestFindGidOffset(t *testing.T) {
 	}
 }
 
+func TestParseGid(t *testing.T) {
+	tests := []struct {
+		header string
+		id     GoID
+	}{
+		{"goroutine 4707 [running]:\n", 4707},
+		{"goroutine 1 [running]:", 1},
+		{"goroutine  4707  [running]:", 4707},
+		{"goroutine 4707[running]:", 4707},
+		{"goroutine 4707 (running):", 4707},
+		{"goroutine\t4707 [running]:", 4707},
+		{"  goroutine 4707 [running]:", 4707},
+		{"goroutine #4707 [running]:", 4707},
+		{"goroutine 9223372036854775807 [running]:", 9223372036854775807},
+		{"goroutine 9223372036854775808 [running]:", 0},
+		{"goroutine 4707", 0},
+		{"goroutine [running]:\nmain.main()\n\t/x.go:4 +0x1", 0},
+		{"goroutine\n4707 [", 0},
+		{"fake 4707 [running]:", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if id := parseGid([]byte(test.header)); id != test.id {
+			t.Errorf("parseGid(%q) = %d, expected %d", test.header, id, test.id)
+		}
+	}
+}
+
 func testGid(t *testing.T, getGid func() GoID) {
 	t.Helper()
 	gidMap := make(map[GoID]bool)
@@ -92,7 +597,7 @@ func testGid(t *testing.T, getGid func() GoID) {
 		go func() {
 			mu.Lock()
 			defer mu.Unlock()
-			gid := fastGid()
+			gid := getGid()
 			gidMap[gid] = true
 			if gid > 0 {
 				waitCh <- true
@@ -111,10 +616,406 @@ func testGid(t *testing.T, getGid func() GoID) {
 	}
 }
 
+func TestReadGid(t *testing.T) {
+	// Headers around the size of the initial buffer, padded to mimic a
+	// format change
+	for pad := 0; pad < 64; pad++ {
+		for _, id := range []GoID{1, 4711, math.MaxInt64} {
+			header := "goroutine " + strings.Repeat(" ", pad) +
+				strconv.FormatInt(int64(id), 10) + " [running]:\nmain.main()\n"
+			var calls int
+			stack := func(buf []byte, all bool) int {
+				calls++
+				return copy(buf, header)
+			}
+			if got := readGid(stack); got != id {
+				t.Errorf("readGid() = %d with header %q, expected %d", got, header, id)
+			}
+			if len(header) < 32 && calls != 1 {
+				t.Errorf("readGid() called stack %d times with a header of %d bytes", calls, len(header))
+			}
+		}
+	}
+
+	// Give up on garbage, rather than growing forever
+	var calls int
+	stack := func(buf []byte, all bool) int {
+		calls++
+		for i := range buf {
+			buf[i] = 'x'
+		}
+		return len(buf)
+	}
+	if got := readGid(stack); got != 0 {
+		t.Errorf("readGid() = %d on garbage, expected 0", got)
+	}
+	if calls > 6 {
+		t.Errorf("readGid() called stack %d times on garbage", calls)
+	}
+}
+
+// parseGidString is the former, string based parseGid, as a reference
+func parseGidString(str string) GoID {
+	str = strings.TrimLeft(str, " \t")
+	keyword := strings.TrimSpace(goroutinePrefix)
+	if keyword == "" || !strings.HasPrefix(str, keyword) {
+		return 0
+	}
+	str = str[len(keyword):]
+
+	start := strings.IndexFunc(str, func(r rune) bool {
+		return r >= '0' && r <= '9' || r == '\n' || r == '['
+	})
+	if start < 0 || str[start] == '\n' || str[start] == '[' {
+		return 0
+	}
+	str = str[start:]
+
+	end := strings.IndexFunc(str, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if end < 0 {
+		return 0
+	}
+	if id, err := strconv.ParseInt(str[:end], 10, gidSize*8); err == nil {
+		return GoID(id)
+	}
+	return 0
+}
+
+func TestParseGidMatchesString(t *testing.T) {
+	prefixes := []string{"", " ", "\t ", "goroutine", "goroutine ", "  goroutine\t", "gorout", "fake ", "Goroutine "}
+	middles := []string{"", " ", "#", "  ", "\n", "[", "é", "id="}
+	ids := []string{"", "0", "1", "4707", "007", "9223372036854775807", "9223372036854775808",
+		"99999999999999999999", "-1", "1é"}
+	suffixes := []string{"", " [running]:", "[", " ", "\n", "x", "é"}
+	for _, prefix := range prefixes {
+		for _, middle := range middles {
+			for _, id := range ids {
+				for _, suffix := range suffixes {
+					header := prefix + middle + id + suffix
+					if got, expected := parseGid([]byte(header)), parseGidString(header); got != expected {
+						t.Errorf("parseGid(%q) = %d, the string parser returned %d", header, got, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func FuzzSlowGidParse(f *testing.F) {
+	f.Add([]byte("goroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1d\n"), int64(1))
+	f.Add([]byte("goroutine 4707 [chan receive, 5 minutes]:\n"), int64(4707))
+	f.Add([]byte("goroutine 9223372036854775807 [running]:\n"), int64(math.MaxInt64))
+	f.Add([]byte("goroutine 7 [select]:\nmain.f()\n\t/src/main.go:9 +0x1\n"+
+		"created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d\n"), int64(7))
+	f.Add([]byte("goroutine 18446744073709551616 [running]:"), int64(0))
+	f.Add([]byte("goroutine [running]:"), int64(0))
+	f.Add([]byte(""), int64(0))
+
+	f.Fuzz(func(t *testing.T, b []byte, n int64) {
+		id := parseGid(b)
+		if id < 0 {
+			t.Fatalf("parseGid(%q) returned negative id %d", b, id)
+		}
+		if expected := parseGidString(string(b)); id != expected {
+			t.Fatalf("parseGid(%q) = %d, the string parser returned %d", b, id, expected)
+		}
+
+		// Well-formed headers yield the embedded number
+		if n < 0 {
+			n = -(n + 1)
+		}
+		header := "goroutine " + strconv.FormatInt(n, 10) + " [running]:\n"
+		if id := parseGid([]byte(header)); id != GoID(n) {
+			t.Fatalf("parseGid(%q) = %d, expected %d", header, id, n)
+		}
+	})
+}
+
+func TestSlowGidAllocs(t *testing.T) {
+	if allocs := testing.AllocsPerRun(100, func() {
+		Unused = slowGid()
+	}); allocs != 0 {
+		t.Errorf("slowGid() allocated %v times per call", allocs)
+	}
+}
+
+func TestGetGoIDUnsafe(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	if id := GetGoIDUnsafe(); id != slowGid() {
+		t.Errorf("GetGoIDUnsafe() = %d, expected %d", id, slowGid())
+	}
+	done := make(chan GoID)
+	go func() {
+		done <- GetGoIDUnsafe() - slowGid()
+	}()
+	if diff := <-done; diff != 0 {
+		t.Errorf("GetGoIDUnsafe() is off by %d in a spawned goroutine", diff)
+	}
+}
+
+func TestGetGoIDSafe(t *testing.T) {
+	if id := GetGoIDSafe(); id != slowGid() {
+		t.Errorf("GetGoIDSafe() = %d, expected %d", id, slowGid())
+	}
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+
+	// Point the fast path to the last page of the address space, which is
+	// never mapped, so that reading it faults
+	defer func() {
+		safeFastGid = fastGid
+	}()
+	safeFastGid = func() GoID {
+		g := getg()
+		bad := ^uintptr(0)&^0xfff - uintptr(unsafe.Pointer(g))
+		return gidFromG(g, int(bad))
+	}
+	done := make(chan GoID)
+	go func() {
+		done <- GetGoIDSafe() - slowGid()
+	}()
+	if diff := <-done; diff != 0 {
+		t.Errorf("GetGoIDSafe() is off by %d after a fault", diff)
+	}
+	if id := GetGoIDSafe(); id != slowGid() {
+		t.Errorf("GetGoIDSafe() = %d after a fault, expected %d", id, slowGid())
+	}
+}
+
+func TestSetFastPathEnabled(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	ids := func() (GoID, GoID) {
+		ch := make(chan GoID)
+		go func() {
+			ch <- GetGoID()
+		}()
+		return GetGoID(), <-ch
+	}
+	fastID, fastSpawned := ids()
+
+	if !SetFastPathEnabled(false) {
+		t.Errorf("expected SetFastPathEnabled to report the fast path on")
+	}
+	if FastGetGoIDAvailable() {
+		t.Errorf("expected the fast path to be unavailable while off")
+	}
+	slowID, slowSpawned := ids()
+	if slowID != fastID || slowSpawned <= fastSpawned {
+		t.Errorf("slow path returned %d and %d, expected %d and more than %d",
+			slowID, slowSpawned, fastID, fastSpawned)
+	}
+	if id := GetGoIDChecked(); id != fastID {
+		t.Errorf("GetGoIDChecked() = %d while off, expected %d", id, fastID)
+	}
+
+	if SetFastPathEnabled(true) {
+		t.Errorf("expected SetFastPathEnabled to report the fast path off")
+	}
+	if !FastGetGoIDAvailable() {
+		t.Errorf("expected the fast path to be available again")
+	}
+	if id, _ := ids(); id != fastID {
+		t.Errorf("GetGoID() = %d after restoring the fast path, expected %d", id, fastID)
+	}
+}
+
+func TestSetFastPathEnabledConcurrently(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	defer SetFastPathEnabled(true)
+
+	// Calls which passed the availability check while the fast path was
+	// turned off must not turn it back on
+	const calls = 2000
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			expected := slowGid()
+			for j := 0; j < calls; j++ {
+				if id := GetGoID(); id != expected {
+					t.Errorf("GetGoID() = %d, expected %d", id, expected)
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < calls; i++ {
+			SetFastPathEnabled(i%2 == 1)
+			runtime.Gosched()
+		}
+		SetFastPathEnabled(false)
+	}()
+	wg.Wait()
+	if atomic.LoadUint32(&fastPathReady) != 0 {
+		t.Errorf("fastPathReady set while the fast path is off")
+	}
+
+	// A call which checked availability just before the fast path was turned
+	// off arms it only after
+	armFastPath()
+	if atomic.LoadUint32(&fastPathReady) != 0 {
+		t.Errorf("armFastPath() set fastPathReady while the fast path is off")
+	}
+}
+
+func TestGoIDsNotReused(t *testing.T) {
+	// Goroutines which run one after another reuse the same few "g", yet each
+	// gets an id of its own
+	const count = 10000
+	seen := make(map[GoID]bool, count)
+	ids := make(chan GoID)
+	for i := 0; i < count; i++ {
+		go func() {
+			ids <- GetGoID()
+		}()
+		id := <-ids
+		if seen[id] {
+			t.Fatalf("id %d reused after %d goroutines", id, i)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNoDuplicatesStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+
+	const (
+		waveCount = 10
+		waveSize  = 10000
+	)
+	for wave := 0; wave < waveCount; wave++ {
+		// All goroutines of a wave are live at the same time, so their ids
+		// must be unique. Ids may be reused across waves.
+		ids := make(chan GoID, waveSize)
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(waveSize)
+		for i := 0; i < waveSize; i++ {
+			go func() {
+				defer wg.Done()
+				ids <- fastGid()
+				<-release
+			}()
+		}
+
+		seen := make(map[GoID]bool, waveSize)
+		for i := 0; i < waveSize; i++ {
+			gid := <-ids
+			if gid <= 0 {
+				t.Fatalf("wave %d: invalid gid %d", wave, gid)
+			}
+			if seen[gid] {
+				t.Fatalf("wave %d: duplicate gid %d among live goroutines", wave, gid)
+			}
+			seen[gid] = true
+		}
+		close(release)
+		wg.Wait()
+		runtime.GC()
+	}
+}
+
+func TestGIDUnderGC(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	stop := make(chan struct{})
+	gcDone := make(chan struct{})
+	go func() {
+		defer close(gcDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.GC()
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-gcDone
+	}()
+
+	const (
+		rounds    = 50
+		roundSize = 1000
+	)
+	for round := 0; round < rounds; round++ {
+		errs := make(chan string, roundSize)
+		var wg sync.WaitGroup
+		wg.Add(roundSize)
+		for i := 0; i < roundSize; i++ {
+			go func() {
+				defer wg.Done()
+				// Allocate to give the GC something to do
+				garbage := make([]byte, 1024)
+				gid := GetGoID()
+				runtime.Gosched()
+				if gid <= 0 || gid != GetGoID() || gid != slowGid() {
+					errs <- fmt.Sprintf("gid %d, slowGid %d", gid, slowGid())
+				}
+				runtime.KeepAlive(garbage)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("round %d: %s", round, err)
+		}
+	}
+}
+
 func TestFastGid(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
 	testGid(t, fastGid)
 }
 
+func TestFastGidMatchesSlowGid(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	testCount := 1000
+	mismatches := make(chan [2]GoID, testCount)
+	var wg sync.WaitGroup
+	wg.Add(testCount)
+	for i := 0; i < testCount; i++ {
+		go func() {
+			defer wg.Done()
+			if fast, slow := fastGid(), slowGid(); fast != slow {
+				mismatches <- [2]GoID{fast, slow}
+			}
+		}()
+	}
+	wg.Wait()
+	close(mismatches)
+	for m := range mismatches {
+		t.Errorf("fastGid() = %d, slowGid() = %d", m[0], m[1])
+	}
+}
+
 func TestSlowGid(t *testing.T) {
 	testGid(t, slowGid)
 }
@@ -124,12 +1025,197 @@ func TestGetGoID(t *testing.T) {
 	testGid(t, GetGoID)
 
 	// slowGid
-	temp := gidOffset
-	defer func() {
+	forceSlowPath(t)
+	testGid(t, GetGoID)
+}
+
+// TestSlowPathFallback covers the behavior on platforms without assembly,
+// where offset detection fails. To cover the build without a fast path, also
+// run the tests with -tags goid_safe, see TestFastPathDisabled.
+func TestSlowPathFallback(t *testing.T) {
+	forceSlowPath(t)
+
+	if FastGetGoIDAvailable() {
+		t.Errorf("FastGetGoIDAvailable() = true without an offset")
+	}
+	if offset := DetectedOffset(); offset != -1 {
+		t.Errorf("DetectedOffset() = %d, expected -1", offset)
+	}
+	testGid(t, GetGoID)
+	testGid(t, MustGetGoID)
+	testGid(t, GetGoIDChecked)
+	if id, err := GetGoIDErr(); err != nil || id != slowGid() {
+		t.Errorf("GetGoIDErr() = %d, %v; expected %d, nil", id, err, slowGid())
+	}
+}
+
+// forceSlowPath makes GetGoID take the slow path for the duration of a test
+func forceSlowPath(t *testing.T) {
+	t.Helper()
+	temp := DetectedOffset()
+	t.Cleanup(func() {
 		gidOffset = temp
-	}()
+	})
 	gidOffset = -1
+	atomic.StoreUint32(&fastPathReady, 0)
+}
+
+// fakeGoroutinePrefix makes parsing stack headers, and thus slowGid, fail for
+// the duration of a test. It first waits for the exit watcher to stop, since
+// it parses stack headers too.
+func fakeGoroutinePrefix(t *testing.T) {
+	t.Helper()
+	fastExitPolling(t)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		exitMu.Lock()
+		watching := exitWatching
+		exitMu.Unlock()
+		if !watching {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("exit watcher still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	temp := goroutinePrefix
+	t.Cleanup(func() {
+		goroutinePrefix = temp
+	})
+	goroutinePrefix = "fake "
+}
+
+func TestFastPathDisabled(t *testing.T) {
+	if fastPathEnabled {
+		t.Skip("fast path enabled, run with -tags goid_safe")
+	}
+	if FastGetGoIDAvailable() || DetectedOffset() != -1 {
+		t.Errorf("fast path available with the goid_safe build tag")
+	}
+	if _, _, err := DetectionReport(); err == nil || !strings.Contains(err.Error(), "goid_safe") {
+		t.Errorf("expected DetectionReport() to blame the goid_safe build tag, got %v", err)
+	}
+	if _, ok := GetGStatus(); ok {
+		t.Errorf("GetGStatus() succeeded with the goid_safe build tag")
+	}
+	if err := VerifyGoIDOffset(); err == nil {
+		t.Errorf("VerifyGoIDOffset() succeeded with the goid_safe build tag")
+	}
 	testGid(t, GetGoID)
+	testGid(t, GetGoIDChecked)
+	testGid(t, MustGetGoID)
+}
+
+func TestCallerGoID(t *testing.T) {
+	gid := GetGoID()
+
+	var nested func(depth int) GoID
+	nested = func(depth int) GoID {
+		if depth == 0 {
+			return CallerGoID(depth)
+		}
+		var id GoID
+		func() {
+			defer func() {
+				id = nested(depth - 1)
+			}()
+		}()
+		return id
+	}
+	for depth := 0; depth < 5; depth++ {
+		if id := nested(depth); id != gid {
+			t.Errorf("CallerGoID at depth %d = %d, expected %d", depth, id, gid)
+		}
+	}
+}
+
+func TestOnFirstGetGoID(t *testing.T) {
+	// Pretend GetGoID was never called
+	firstGetGoIDMu.Lock()
+	atomic.StoreUint32(&firstGetGoIDDone, 0)
+	atomic.StoreUint32(&fastPathReady, 0)
+	firstGetGoIDMu.Unlock()
+
+	var calls int
+	var usedFast bool
+	OnFirstGetGoID(func(usedFastPath bool) {
+		calls++
+		usedFast = usedFastPath
+	})
+	if calls != 0 {
+		t.Fatalf("hook fired before GetGoID was called")
+	}
+
+	GetGoID()
+	GetGoID()
+	if calls != 1 {
+		t.Fatalf("expected hook to fire once, fired %d times", calls)
+	}
+	if usedFast != FastGetGoIDAvailable() {
+		t.Errorf("hook reported usedFastPath=%v, expected %v", usedFast, FastGetGoIDAvailable())
+	}
+
+	// Registering after the first call fires right away
+	var late bool
+	OnFirstGetGoID(func(usedFastPath bool) {
+		late = true
+	})
+	if !late {
+		t.Errorf("hook registered after the first GetGoID did not fire")
+	}
+}
+
+func TestGetGoIDErr(t *testing.T) {
+	if id, err := GetGoIDErr(); err != nil || id != slowGid() {
+		t.Errorf("GetGoIDErr() = %d, %v; expected %d, nil", id, err, slowGid())
+	}
+
+	// slow path
+	forceSlowPath(t)
+	if id, err := GetGoIDErr(); err != nil || id != slowGid() {
+		t.Errorf("GetGoIDErr() = %d, %v on the slow path; expected %d, nil", id, err, slowGid())
+	}
+
+	// let slowGid() fail
+	fakeGoroutinePrefix(t)
+	id, err := GetGoIDErr()
+	if id != 0 || !errors.Is(err, ErrGoIDUnavailable) {
+		t.Fatalf("GetGoIDErr() = %d, %v; expected 0, ErrGoIDUnavailable", id, err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "not found") ||
+		!strings.Contains(msg, `"goroutine `) {
+		t.Errorf("expected the error to tell both causes and the header, got %q", msg)
+	}
+	if id := GetGoID(); id != 0 {
+		t.Errorf("GetGoID() = %d, expected 0", id)
+	}
+}
+
+func TestMustGetGoID(t *testing.T) {
+	if id := MustGetGoID(); id != slowGid() || id.IsZero() {
+		t.Errorf("MustGetGoID() = %d, expected %d", id, slowGid())
+	}
+
+	forceSlowPath(t)
+	fakeGoroutinePrefix(t)
+	if id := GetGoID(); !id.IsZero() {
+		t.Errorf("GetGoID() = %d, expected IsZero()", id)
+	}
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, ErrGoIDUnavailable) {
+			t.Fatalf("expected MustGetGoID to panic with ErrGoIDUnavailable, got %v", err)
+		}
+		msg := err.Error()
+		if !strings.Contains(msg, "fast path available: false") ||
+			!strings.Contains(msg, "slow path failed: true") {
+			t.Errorf("expected the panic to tell which paths failed, got %q", msg)
+		}
+	}()
+	MustGetGoID()
 }
 
 // To disable dead code optimization which would defeat the benchmarks
@@ -144,7 +1230,27 @@ func BenchmarkSlowGid(b *testing.B) {
 	Unused = gid
 }
 
+func BenchmarkDetection(b *testing.B) {
+	defer SetDetectionEffort(DetectionEffortMedium)
+	for _, effort := range []struct {
+		name  string
+		level int
+	}{
+		{"Low", DetectionEffortLow},
+		{"Medium", DetectionEffortMedium},
+		{"High", DetectionEffortHigh},
+	} {
+		b.Run(effort.name, func(b *testing.B) {
+			SetDetectionEffort(effort.level)
+			for i := 0; i < b.N; i++ {
+				getGidOffset()
+			}
+		})
+	}
+}
+
 func BenchmarkFastGid(b *testing.B) {
+	FastGetGoIDAvailable()
 	b.ReportAllocs()
 	var gid GoID
 	for i := 0; i < b.N; i++ {
@@ -153,6 +1259,20 @@ func BenchmarkFastGid(b *testing.B) {
 	Unused = gid
 }
 
+// BenchmarkGetGoIDParallel measures how GetGoID scales across Ps, which it
+// should do perfectly, as the fast path shares no mutable state
+func BenchmarkGetGoIDParallel(b *testing.B) {
+	FastGetGoIDAvailable()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var gid GoID
+		for pb.Next() {
+			gid = GetGoID()
+		}
+		runtime.KeepAlive(gid)
+	})
+}
+
 func BenchmarkGetGoID(b *testing.B) {
 	b.ReportAllocs()
 	var gid GoID
@@ -161,3 +1281,17 @@ func BenchmarkGetGoID(b *testing.B) {
 	}
 	Unused = gid
 }
+
+// BenchmarkGetGoIDUnsafe measures what skipping the availability check of
+// GetGoID saves, compare with BenchmarkGetGoID
+func BenchmarkGetGoIDUnsafe(b *testing.B) {
+	if !FastGetGoIDAvailable() {
+		b.Skip("fast path not available")
+	}
+	b.ReportAllocs()
+	var gid GoID
+	for i := 0; i < b.N; i++ {
+		gid = GetGoIDUnsafe()
+	}
+	Unused = gid
+}
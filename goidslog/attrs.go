@@ -0,0 +1,31 @@
+//go:build go1.21
+
+package goidslog
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/observeinc/goid"
+)
+
+// Attrs returns the id of the current goroutine as a "goid" attribute,
+// followed by the entries of its mapped diagnostic context (see goid.PutMDC)
+// as string attributes sorted by key, so that a handler can append them in one
+// step. Goroutines started by goid.Go inherit the MDC, so their log lines carry
+// the attributes of their parent.
+func Attrs() []slog.Attr {
+	mdc := goid.MDC()
+	keys := make([]string, 0, len(mdc))
+	for k := range mdc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(mdc)+1)
+	attrs = append(attrs, Attr())
+	for _, k := range keys {
+		attrs = append(attrs, slog.String(k, mdc[k]))
+	}
+	return attrs
+}
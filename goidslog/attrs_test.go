@@ -0,0 +1,51 @@
+//go:build go1.21
+
+package goidslog
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/observeinc/goid"
+)
+
+func TestAttrs(t *testing.T) {
+	goid.PutMDC("user_id", "u1")
+	goid.PutMDC("request_id", "r1")
+	defer goid.ClearMDC()
+
+	attrs := Attrs()
+	expected := []slog.Attr{
+		slog.Int64("goid", int64(goid.GetGoID())),
+		slog.String("request_id", "r1"),
+		slog.String("user_id", "u1"),
+	}
+	if len(attrs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, attrs)
+	}
+	for i := range expected {
+		if !attrs[i].Equal(expected[i]) {
+			t.Errorf("attribute %d: expected %v, got %v", i, expected[i], attrs[i])
+		}
+	}
+
+	// A goroutine started by goid.Go logs with the attributes of its parent
+	done := make(chan []slog.Attr)
+	goid.Go(func() {
+		done <- Attrs()
+	})
+	child := <-done
+	if len(child) != len(expected) || child[0].Equal(expected[0]) {
+		t.Fatalf("expected the child's own goid and the parent's MDC, got %v", child)
+	}
+	for i := 1; i < len(expected); i++ {
+		if !child[i].Equal(expected[i]) {
+			t.Errorf("child attribute %d: expected %v, got %v", i, expected[i], child[i])
+		}
+	}
+
+	goid.ClearMDC()
+	if attrs := Attrs(); len(attrs) != 1 || attrs[0].Key != "goid" {
+		t.Errorf("expected only the goid attribute without an MDC, got %v", attrs)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build go1.21
+
+package goidslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/observeinc/goid"
+)
+
+// Attr returns the id of the current goroutine as a "goid" attribute
+func Attr() slog.Attr {
+	return slog.Int64("goid", int64(goid.GetGoID()))
+}
+
+// WithGoID wraps h so that every record it handles carries the id of the
+// goroutine which emitted it, as a "goid" attribute. The id is read when the
+// record is handled, not when the handler is built. Like any attribute added
+// by the handler, it ends up in the groups opened by WithGroup.
+func WithGoID(h slog.Handler) slog.Handler {
+	return goidHandler{h}
+}
+
+type goidHandler struct {
+	slog.Handler
+}
+
+func (h goidHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(Attr())
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h goidHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return goidHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h goidHandler) WithGroup(name string) slog.Handler {
+	return goidHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,42 @@
+//go:build go1.21
+
+package goidslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/observeinc/goid"
+)
+
+func TestAttr(t *testing.T) {
+	if attr := Attr(); !attr.Equal(slog.Int64("goid", int64(goid.GetGoID()))) {
+		t.Errorf("unexpected attribute %v", attr)
+	}
+}
+
+func TestWithGoID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(WithGoID(slog.NewJSONHandler(&buf, nil))).With("app", "test")
+
+	// The id is the one of the emitting goroutine, not the constructing one
+	ids := make(chan goid.GoID)
+	go func() {
+		logger.Info("hello")
+		ids <- goid.GetGoID()
+	}()
+	id := <-ids
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode %q: %v", buf.String(), err)
+	}
+	if record["goid"] != float64(id) || record["app"] != "test" {
+		t.Errorf("expected goid %d and app test, got %v", id, record)
+	}
+	if id == goid.GetGoID() {
+		t.Errorf("test goroutine and logging goroutine have the same id %d", id)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build go1.21
+
+// Package goidslog integrates goroutine ids with log/slog. It is kept apart
+// from package goid so that users who don't use slog aren't forced to compile
+// it.
+package goidslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is the request header whose value HTTPLoggingMiddleware uses
+// as the request id. A random id is generated when it is absent.
+const RequestIDHeader = "X-Request-Id"
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx by NewContext or
+// HTTPLoggingMiddleware, or slog.Default() if there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// HTTPLoggingMiddleware returns a middleware which derives a logger from
+// logger, tagged with the id of the goroutine serving the request and with the
+// request id, and stores it in the request context. Handlers retrieve it via
+// FromContext.
+func HTTPLoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = newRequestID()
+			}
+			l := logger.With(
+				Attr(),
+				slog.String("request_id", requestID),
+			)
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), l)))
+		})
+	}
+}
+
+// newRequestID generates a random 16 hex digit request id
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
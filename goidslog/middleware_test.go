@@ -0,0 +1,88 @@
+//go:build go1.21
+
+package goidslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/observeinc/goid"
+)
+
+func TestHTTPLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	var handlerGid goid.GoID
+	handler := HTTPLoggingMiddleware(logger)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			handlerGid = goid.GetGoID()
+			FromContext(r.Context()).Info("handling")
+		},
+	))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(RequestIDHeader, "req-4711")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var record struct {
+		Msg       string `json:"msg"`
+		GoID      int64  `json:"goid"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to parse log record %q: %v", buf.String(), err)
+	}
+	if record.Msg != "handling" {
+		t.Errorf("unexpected message %q", record.Msg)
+	}
+	if record.GoID == 0 || record.GoID != int64(handlerGid) {
+		t.Errorf("expected goid %d, got %d", handlerGid, record.GoID)
+	}
+	if record.RequestID != "req-4711" {
+		t.Errorf("expected request_id %q, got %q", "req-4711", record.RequestID)
+	}
+}
+
+func TestHTTPLoggingMiddlewareGeneratesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := HTTPLoggingMiddleware(logger)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Info("handling")
+		},
+	))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var record struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to parse log record %q: %v", buf.String(), err)
+	}
+	if len(record.RequestID) != 16 {
+		t.Errorf("expected a generated 16 digit request id, got %q", record.RequestID)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != slog.Default() {
+		t.Errorf("expected FromContext to fall back to slog.Default()")
+	}
+}
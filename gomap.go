@@ -0,0 +1,54 @@
+package goid
+
+import "sync"
+
+// GoMap maps goroutine ids to values of type T, on top of sync.Map. Unlike
+// Local, it takes the id explicitly, so any goroutine may look up the value of
+// another one, e.g. to inspect what it registered. The zero value is ready to
+// use.
+//
+// Entries are kept until deleted, unless stored with StoreOwn, which deletes
+// them once their goroutine exits, like AutoLocal.
+type GoMap[T any] struct {
+	m     sync.Map
+	watch exitWatch
+}
+
+// Store sets the value of id
+func (m *GoMap[T]) Store(id GoID, v T) {
+	m.m.Store(id, v)
+}
+
+// StoreOwn sets the value of the current goroutine, which is deleted once the
+// goroutine exits, see OnExit
+func (m *GoMap[T]) StoreOwn(v T) {
+	id := GetGoID()
+	m.m.Store(id, v)
+	m.watch.watch(id, func() {
+		m.m.Delete(id)
+	})
+}
+
+// Load returns the value of id, and whether it has one
+func (m *GoMap[T]) Load(id GoID) (T, bool) {
+	v, ok := m.m.Load(id)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// Delete removes the value of id
+func (m *GoMap[T]) Delete(id GoID) {
+	m.m.Delete(id)
+}
+
+// Range calls fn for each id and its value, in no particular order, until fn
+// returns false. As with sync.Map, entries stored or deleted meanwhile may or
+// may not be visited.
+func (m *GoMap[T]) Range(fn func(id GoID, v T) bool) {
+	m.m.Range(func(id, v interface{}) bool {
+		return fn(id.(GoID), v.(T))
+	})
+}
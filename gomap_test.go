@@ -0,0 +1,96 @@
+package goid
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoMap(t *testing.T) {
+	var m GoMap[string]
+	if v, ok := m.Load(1); ok {
+		t.Fatalf("expected no value, got %q", v)
+	}
+
+	const count = 100
+	var wg sync.WaitGroup
+	ids := make(chan GoID, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := GetGoID()
+			m.Store(id, strconv.FormatInt(int64(id), 10))
+			if v, ok := m.Load(id); !ok || v != strconv.FormatInt(int64(id), 10) {
+				t.Errorf("Load(%d) = %q, %v; expected %q, true", id, v, ok, strconv.FormatInt(int64(id), 10))
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	// Values outlive their goroutines, and are visible from others
+	seen := make(map[GoID]bool)
+	m.Range(func(id GoID, v string) bool {
+		if v != strconv.FormatInt(int64(id), 10) {
+			t.Errorf("Range passed %d, %q; expected %q", id, v, strconv.FormatInt(int64(id), 10))
+		}
+		seen[id] = true
+		return true
+	})
+	for id := range ids {
+		if !seen[id] {
+			t.Errorf("goroutine %d not visited by Range", id)
+		}
+		m.Delete(id)
+		if _, ok := m.Load(id); ok {
+			t.Errorf("goroutine %d still has a value after Delete", id)
+		}
+	}
+
+	calls := 0
+	m.Store(1, "one")
+	m.Store(2, "two")
+	m.Range(func(GoID, string) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("Range went on after fn returned false, %d calls", calls)
+	}
+}
+
+func TestGoMapStoreOwn(t *testing.T) {
+	fastExitPolling(t)
+
+	var m GoMap[int]
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	go func() {
+		m.StoreOwn(1)
+		m.StoreOwn(2)
+		ids <- GetGoID()
+		<-release
+	}()
+	id := <-ids
+	if v, ok := m.Load(id); !ok || v != 2 {
+		t.Errorf("Load(%d) = %d, %v; expected 2, true", id, v, ok)
+	}
+	close(release)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, ok := m.Load(id); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the value of goroutine %d to be deleted once it exited", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := m.watch.watched.Load(id); ok {
+		t.Errorf("goroutine %d still watched after it exited", id)
+	}
+}
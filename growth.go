@@ -0,0 +1,150 @@
+package goid
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// GrowthError is returned by CheckGrowth when the number of goroutines grew by
+// more than allowed
+type GrowthError struct {
+	Growth    int             // How many goroutines were added
+	MaxGrowth int             // How many goroutines were allowed to be added
+	New       []GoroutineInfo // The goroutines which are not in the baseline
+}
+
+func (e *GrowthError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goid: goroutine count grew by %d, more than %d; new goroutines:",
+		e.Growth, e.MaxGrowth)
+	for _, info := range e.New {
+		fmt.Fprintf(&b, "\n\tgoroutine %d [%s]", info.ID, info.State)
+		if function, location := parseGoroutineCreatedBy([]byte(info.Stack)); function != "" {
+			fmt.Fprintf(&b, " created by %s at %s", function, location)
+		}
+	}
+	return b.String()
+}
+
+// CheckGrowth compares the live goroutines against baseline, as returned by an
+// earlier ListGoroutines, and returns a *GrowthError if their number grew by
+// more than maxGrowth. The error lists the goroutines which are not in the
+// baseline, along with where they were created. This is meant as a leak gate
+// for long-running tests, where some growth is expected.
+//
+// Only user goroutines are counted, on both sides: goroutines created by the
+// runtime and the background goroutine of OnExit, which comes and goes with
+// exit callbacks, are left out.
+func CheckGrowth(baseline []GoroutineInfo, maxGrowth int) error {
+	infos, err := ListGoroutines()
+	if err != nil {
+		return err
+	}
+	infos = userGoroutines(infos)
+	baseline = userGoroutines(baseline)
+
+	growth := len(infos) - len(baseline)
+	if growth <= maxGrowth {
+		return nil
+	}
+
+	old := make(map[GoID]bool, len(baseline))
+	for _, info := range baseline {
+		old[info.ID] = true
+	}
+	e := &GrowthError{Growth: growth, MaxGrowth: maxGrowth}
+	for _, info := range infos {
+		if !old[info.ID] {
+			e.New = append(e.New, info)
+		}
+	}
+	return e
+}
+
+// watchExitsFrame starts the frame of watchExits in a stack, such as
+// "\ngithub.com/observeinc/goid.watchExits("
+var watchExitsFrame = "\n" + runtime.FuncForPC(reflect.ValueOf(watchExits).Pointer()).Name() + "("
+
+// userGoroutines returns the goroutines of infos which are neither created by
+// the runtime nor running watchExits. Goroutines without a stack are kept.
+func userGoroutines(infos []GoroutineInfo) []GoroutineInfo {
+	var user []GoroutineInfo
+	for _, info := range infos {
+		function, _ := parseGoroutineCreatedBy([]byte(info.Stack))
+		if strings.HasPrefix(function, "runtime.") || strings.Contains(info.Stack, watchExitsFrame) {
+			continue
+		}
+		user = append(user, info)
+	}
+	return user
+}
+
+// LeakOption configures Leaked
+type LeakOption func(*leakOptions)
+
+type leakOptions struct {
+	stacks bool
+}
+
+// WithStacks makes Leaked fill in the Stack of each leaked goroutine, whose
+// frames GoroutineInfo.Frames parses
+func WithStacks() LeakOption {
+	return func(o *leakOptions) {
+		o.stacks = true
+	}
+}
+
+// Leaked returns the live goroutines which are not in baseline, as returned by
+// an earlier Snapshot or ListGoroutines. Like Snapshot, it leaves their Stack
+// empty, unless WithStacks is passed: the stacks are then taken from a second
+// dump, and goroutines which exited in between are left out. The stacks are
+// kept in the runtime.Stack format, which can be printed as is, and
+// GoroutineInfo.Frames turns one into a []Frame.
+func Leaked(baseline []GoroutineInfo, opts ...LeakOption) ([]GoroutineInfo, error) {
+	var o leakOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	infos, err := Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[GoID]bool, len(baseline))
+	for _, info := range baseline {
+		old[info.ID] = true
+	}
+	var leaked []GoroutineInfo
+	for _, info := range infos {
+		if !old[info.ID] {
+			leaked = append(leaked, info)
+		}
+	}
+	if !o.stacks || len(leaked) == 0 {
+		return leaked, nil
+	}
+
+	full, err := ListGoroutines()
+	if err != nil {
+		return nil, err
+	}
+	return withStacks(leaked, full), nil
+}
+
+// withStacks returns the goroutines of leaked which are in full, with their
+// info from full, which includes the stack
+func withStacks(leaked, full []GoroutineInfo) []GoroutineInfo {
+	byID := make(map[GoID]GoroutineInfo, len(full))
+	for _, info := range full {
+		byID[info.ID] = info
+	}
+	alive := leaked[:0]
+	for _, info := range leaked {
+		if info, ok := byID[info.ID]; ok {
+			alive = append(alive, info)
+		}
+	}
+	return alive
+}
@@ -0,0 +1,167 @@
+package goid
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// leakyWorker blocks until release is closed
+func leakyWorker(release chan struct{}) {
+	<-release
+}
+
+func TestCheckGrowth(t *testing.T) {
+	baseline, err := ListGoroutines()
+	if err != nil {
+		t.Fatalf("ListGoroutines failed: %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan GoID)
+	for i := 0; i < 3; i++ {
+		go func() {
+			started <- GetGoID()
+			leakyWorker(release)
+		}()
+	}
+	leaked := make(map[GoID]bool)
+	for i := 0; i < 3; i++ {
+		leaked[<-started] = true
+	}
+
+	if err := CheckGrowth(baseline, 10); err != nil {
+		t.Errorf("CheckGrowth within budget failed: %v", err)
+	}
+
+	err = CheckGrowth(baseline, 1)
+	var growthErr *GrowthError
+	if !errors.As(err, &growthErr) {
+		t.Fatalf("expected a *GrowthError, got %v", err)
+	}
+	if growthErr.MaxGrowth != 1 {
+		t.Errorf("expected MaxGrowth 1, got %d", growthErr.MaxGrowth)
+	}
+	for _, info := range growthErr.New {
+		delete(leaked, info.ID)
+	}
+	if len(leaked) != 0 {
+		t.Errorf("leaked goroutines not reported: %v", leaked)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "created by github.com/observeinc/goid.TestCheckGrowth") {
+		t.Errorf("expected the error to name the creation site, got %q", msg)
+	}
+}
+
+func TestCheckGrowthSkipsExitWatcher(t *testing.T) {
+	// Keep the exit watcher running
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan GoID)
+	go func() {
+		started <- GetGoID()
+		leakyWorker(release)
+	}()
+	OnGoroutineExit(<-started, func() {})
+
+	infos, err := ListGoroutines()
+	if err != nil {
+		t.Fatalf("ListGoroutines failed: %v", err)
+	}
+	// A baseline taken before the watcher started
+	var baseline []GoroutineInfo
+	for _, info := range infos {
+		if !strings.Contains(info.Stack, "goid.watchExits(") {
+			baseline = append(baseline, info)
+		}
+	}
+	if len(baseline) == len(infos) {
+		t.Fatalf("exit watcher not found in %d goroutines", len(infos))
+	}
+
+	if err := CheckGrowth(baseline, 0); err != nil {
+		t.Errorf("CheckGrowth reported the exit watcher: %v", err)
+	}
+}
+
+func TestUserGoroutines(t *testing.T) {
+	infos := []GoroutineInfo{
+		{ID: 1, Stack: "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x1"},
+		{ID: 2, Stack: "goroutine 2 [sleep]:\ntime.Sleep(0x5f5e100)\n\t/go/time.go:1 +0x1\n" +
+			"github.com/observeinc/goid.watchExits()\n\t/src/exit.go:130 +0x1\n" +
+			"created by github.com/observeinc/goid.onExit in goroutine 1\n\t/src/exit.go:101 +0x1"},
+		{ID: 3, Stack: "goroutine 3 [finalizer wait]:\nruntime.runfinq()\n\t/go/mfinal.go:1 +0x1\n" +
+			"created by runtime.createfing in goroutine 1\n\t/go/mfinal.go:2 +0x1"},
+		{ID: 4, Stack: "goroutine 4 [chan receive]:\nmain.f()\n\t/src/main.go:9 +0x1\n" +
+			"created by main.main in goroutine 1\n\t/src/main.go:4 +0x1d"},
+		{ID: 5},
+	}
+	user := userGoroutines(infos)
+	if len(user) != 3 || user[0].ID != 1 || user[1].ID != 4 || user[2].ID != 5 {
+		t.Errorf("userGoroutines() = %+v, expected goroutines 1, 4 and 5", user)
+	}
+}
+
+func TestLeaked(t *testing.T) {
+	baseline, err := Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan GoID)
+	go func() {
+		started <- GetGoID()
+		leakyWorker(release)
+	}()
+	id := <-started
+
+	find := func(infos []GoroutineInfo) (GoroutineInfo, bool) {
+		for _, info := range infos {
+			if info.ID == id {
+				return info, true
+			}
+		}
+		return GoroutineInfo{}, false
+	}
+
+	leaked, err := Leaked(baseline)
+	if err != nil {
+		t.Fatalf("Leaked failed: %v", err)
+	}
+	if info, ok := find(leaked); !ok || info.Stack != "" {
+		t.Errorf("expected goroutine %d to be reported without its stack, got %+v", id, leaked)
+	}
+
+	leaked, err = Leaked(baseline, WithStacks())
+	if err != nil {
+		t.Fatalf("Leaked(WithStacks()) failed: %v", err)
+	}
+	info, ok := find(leaked)
+	if !ok || !strings.Contains(info.Stack, "goid.leakyWorker") {
+		t.Fatalf("expected goroutine %d to be reported with its stack, got %+v", id, leaked)
+	}
+	if frames := info.Frames(); len(frames) == 0 ||
+		frames[0].Function != "github.com/observeinc/goid.leakyWorker" ||
+		!strings.HasSuffix(frames[0].File, "growth_test.go") || frames[0].Line == 0 {
+		t.Errorf("expected goroutine %d to be in leakyWorker, got frames %+v", id, frames)
+	}
+	for _, info := range leaked {
+		for _, old := range baseline {
+			if info.ID == old.ID {
+				t.Errorf("goroutine %d of the baseline reported as leaked", info.ID)
+			}
+		}
+	}
+}
+
+func TestWithStacksOmitsExited(t *testing.T) {
+	leaked := []GoroutineInfo{{ID: 10}, {ID: 11}, {ID: 12}}
+	full := []GoroutineInfo{{ID: 1, Stack: "main"}, {ID: 10, Stack: "a"}, {ID: 12, Stack: "c"}}
+	got := withStacks(leaked, full)
+	if len(got) != 2 || got[0].Stack != "a" || got[1].Stack != "c" {
+		t.Errorf("withStacks() = %+v, expected goroutines 10 and 12 with their stacks", got)
+	}
+}
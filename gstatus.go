@@ -0,0 +1,117 @@
+package goid
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"unsafe"
+)
+
+// Raw values of the status field of the "g", as returned by GetGStatus. They
+// mirror the _G* constants of package runtime, which may change between Go
+// versions.
+const (
+	GStatusIdle      = 0      // Just allocated, not yet initialized
+	GStatusRunnable  = 1      // On a run queue, not executing user code
+	GStatusRunning   = 2      // Executing user code
+	GStatusSyscall   = 3      // Executing a system call
+	GStatusWaiting   = 4      // Blocked in the runtime, e.g. on a channel
+	GStatusDead      = 6      // Unused, e.g. exited or on a free list
+	GStatusCopystack = 8      // Its stack is being moved
+	GStatusPreempted = 9      // Stopped itself for a preemption
+	GStatusScan      = 0x1000 // Combined with the above while the GC scans
+)
+
+const gStatusSize = (int)(unsafe.Sizeof(uint32(0)))
+
+var (
+	gStatusOnce   sync.Once
+	gStatusOffset = -1
+)
+
+// GetGStatus returns the raw status field of the "g" of the current goroutine,
+// see the GStatus* constants. For the calling goroutine it is essentially
+// always GStatusRunning. Returns false if the status field could not be
+// located.
+//
+// The offset of the status field is detected on the first call, much like the
+// goroutine id offset. With the goid_safe build tag, it always returns false.
+func GetGStatus() (uint32, bool) {
+	if !fastPathEnabled {
+		return 0, false
+	}
+	gStatusOnce.Do(func() {
+		gStatusOffset = getGStatusOffset()
+	})
+	if gStatusOffset < 0 {
+		return 0, false
+	}
+	return statusFromG(getg(), gStatusOffset), true
+}
+
+// getGStatusOffset figures out the offset in the "g" where the status is
+// stored. Candidates are offsets which read GStatusRunning in the current
+// goroutine, and each is cross-validated against the "g" of goroutines
+// blocked on a channel, which must read GStatusWaiting.
+func getGStatusOffset() (offset int) {
+	// Handle segmentation faults in case we run past the "g"
+	oldPanicOnFault := debug.SetPanicOnFault(true)
+	defer func() {
+		if r := recover(); r != nil {
+			offset = -1
+		}
+	}()
+	defer debug.SetPanicOnFault(oldPanicOnFault)
+
+	self := getg()
+	if self == nil {
+		return -1
+	}
+	var candidates []int
+	for offset := 0; offset < gSize; offset += gStatusSize {
+		if statusFromG(self, offset) == GStatusRunning {
+			candidates = append(candidates, offset)
+		}
+	}
+
+	for i := 0; i < checkCount && len(candidates) > 0; i++ {
+		candidates = checkGStatusOffsets(candidates)
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	return candidates[0]
+}
+
+// checkGStatusOffsets blocks a goroutine on a channel and returns the
+// candidate offsets that read GStatusWaiting in its "g" while it is blocked,
+// and GStatusRunning in the current one
+func checkGStatusOffsets(candidates []int) []int {
+	gCh := make(chan *g)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gCh <- getg()
+		<-release
+	}()
+	blocked := <-gCh
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	// Give the goroutine a chance to park. A candidate only needs to read
+	// GStatusWaiting once, since no other field should ever do so.
+	var confirmed []int
+	for try := 0; try < 1000 && len(confirmed) == 0; try++ {
+		runtime.Gosched()
+		for _, offset := range candidates {
+			if statusFromG(blocked, offset)&^GStatusScan == GStatusWaiting &&
+				statusFromG(getg(), offset) == GStatusRunning {
+				confirmed = append(confirmed, offset)
+			}
+		}
+	}
+	return confirmed
+}
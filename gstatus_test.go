@@ -0,0 +1,25 @@
+package goid
+
+import "testing"
+
+func TestGetGStatus(t *testing.T) {
+	if getg() == nil {
+		t.Skip("getg not available")
+	}
+	status, ok := GetGStatus()
+	if !ok {
+		t.Fatalf("GetGStatus failed to locate the status field")
+	}
+	if status != GStatusRunning {
+		t.Errorf("expected status %d for the running goroutine, got %d", GStatusRunning, status)
+	}
+
+	done := make(chan uint32)
+	go func() {
+		status, _ := GetGStatus()
+		done <- status
+	}()
+	if status := <-done; status != GStatusRunning {
+		t.Errorf("expected status %d in a spawned goroutine, got %d", GStatusRunning, status)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build go1.23
+
+package goid
+
+import "iter"
+
+// AllGoroutines returns a sequence of all live goroutines, in stack dump order.
+// The stacks of all goroutines are captured when ranging starts, but they are
+// parsed lazily as the caller ranges, and parsing stops when the caller
+// breaks. The result is a snapshot and inherently racy.
+func AllGoroutines() iter.Seq[GoroutineInfo] {
+	return func(yield func(GoroutineInfo) bool) {
+		withDump(func(dump []byte) {
+			forEachGoroutine(dump, func(id GoID, block []byte) bool {
+				return yield(newGoroutineInfo(id, block))
+			})
+		})
+	}
+}
@@ -0,0 +1,74 @@
+//go:build go1.23
+
+package goid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllGoroutines(t *testing.T) {
+	const blockedCount = 5
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < blockedCount; i++ {
+		go func() {
+			ids <- GetGoID()
+			<-release
+		}()
+	}
+	blocked := make(map[GoID]bool)
+	for i := 0; i < blockedCount; i++ {
+		blocked[<-ids] = true
+	}
+
+	self := GetGoID()
+	var sawSelf bool
+	for info := range AllGoroutines() {
+		if info.ID == self {
+			sawSelf = true
+			if info.State != "running" {
+				t.Errorf("expected the current goroutine to be running, got %q", info.State)
+			}
+			if !strings.Contains(info.Stack, "TestAllGoroutines") {
+				t.Errorf("expected the stack to contain the test function, got %q", info.Stack)
+			}
+		}
+		delete(blocked, info.ID)
+	}
+	if !sawSelf {
+		t.Errorf("current goroutine %d not found", self)
+	}
+	if len(blocked) != 0 {
+		t.Errorf("blocked goroutines not found: %v", blocked)
+	}
+}
+
+func TestAllGoroutinesBreak(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 5; i++ {
+		go func() {
+			<-release
+		}()
+	}
+
+	var parsed int
+	AllGoroutines()(func(info GoroutineInfo) bool {
+		parsed++
+		return false
+	})
+	if parsed != 1 {
+		t.Errorf("expected parsing to stop after 1 goroutine, parsed %d", parsed)
+	}
+
+	var ranged int
+	for range AllGoroutines() {
+		ranged++
+		break
+	}
+	if ranged != 1 {
+		t.Errorf("expected the loop to stop after 1 goroutine, ranged %d", ranged)
+	}
+}
@@ -0,0 +1,74 @@
+package goid
+
+import (
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+// knownOffset identifies an entry of knownOffsets. The layout of the "g" only
+// depends on the Go version and the pointer size, not on the architecture.
+type knownOffset struct {
+	version string // Major and minor version, such as "go1.27"
+	ptrSize uintptr
+}
+
+// knownOffsets holds the offsets of the goroutine id in the "g" observed on
+// Go releases. It only covers go1.27 so far: 152 was detected on linux/amd64
+// and 80 on linux/386, both with go1.27.1. Older versions are left out rather
+// than guessed, since a wrong entry would be used as a fallback. Entries are
+// only added once observed on a release.
+var knownOffsets = map[knownOffset]int{
+	{"go1.27", 8}: 152,
+	{"go1.27", 4}: 80,
+}
+
+// KnownOffset returns the offset of the goroutine id in the "g" observed for
+// the given Go version, as returned by runtime.Version, on platforms with the
+// pointer size of the current one. Patch releases and release candidates
+// share the offset of their minor version. Returns false for versions which
+// aren't in the table, including development versions.
+//
+// Detection cross-checks its result against the table, reporting mismatches
+// through Logf, and falls back to the offset from the table if the vote fails
+// but the offset passes the usual checks.
+func KnownOffset(version string) (int, bool) {
+	offset, ok := knownOffsets[knownOffset{minorVersion(version), unsafe.Sizeof(uintptr(0))}]
+	return offset, ok
+}
+
+// minorVersion trims the patch and prerelease suffixes of a Go version, e.g.
+// "go1.21.3" and "go1.21rc2" to "go1.21"
+func minorVersion(version string) string {
+	if !strings.HasPrefix(version, "go1.") {
+		return ""
+	}
+	i := len("go1.")
+	for i < len(version) && isDigit(version[i]) {
+		i++
+	}
+	if i == len("go1.") {
+		return ""
+	}
+	return version[:i]
+}
+
+// checkKnownOffset cross-checks the offset found by detection, -1 if it failed,
+// against knownOffsets. Returns the offset to use, which is the one from the
+// table if detection failed and the tabled offset passes checkGidOffset.
+func checkKnownOffset(offset int) int {
+	known, ok := KnownOffset(runtime.Version())
+	switch {
+	case !ok || offset == known:
+		return offset
+	case offset >= 0:
+		logf("goid: detected offset %d differs from offset %d known for %s",
+			offset, known, runtime.Version())
+		return offset
+	case known <= gSize-gidSize && checkGidOffset(known):
+		logf("goid: offset detection failed, falling back to offset %d known for %s",
+			known, runtime.Version())
+		return known
+	}
+	return offset
+}
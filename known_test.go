@@ -0,0 +1,80 @@
+package goid
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestMinorVersion(t *testing.T) {
+	for version, expected := range map[string]string{
+		"go1.27":                "go1.27",
+		"go1.27.1":              "go1.27",
+		"go1.21rc2":             "go1.21",
+		"go1.9":                 "go1.9",
+		"devel go1.28-abcdef":   "",
+		"go1.":                  "",
+		"":                      "",
+		"gccgo (GCC) 13.2.0 go": "",
+	} {
+		if v := minorVersion(version); v != expected {
+			t.Errorf("minorVersion(%q) = %q, expected %q", version, v, expected)
+		}
+	}
+}
+
+func TestKnownOffset(t *testing.T) {
+	expected := 152
+	if ptrSize == 4 {
+		expected = 80
+	}
+	for _, version := range []string{"go1.27", "go1.27.1", "go1.27rc1"} {
+		if offset, ok := KnownOffset(version); !ok || offset != expected {
+			t.Errorf("KnownOffset(%q) = %d, %v; expected %d, true", version, offset, ok, expected)
+		}
+	}
+	for _, version := range []string{"go1.5", "go1.270", "devel go1.28-abcdef", ""} {
+		if offset, ok := KnownOffset(version); ok {
+			t.Errorf("KnownOffset(%q) = %d, expected no entry", version, offset)
+		}
+	}
+
+	// The table must agree with detection on the current version
+	known, ok := KnownOffset(runtime.Version())
+	if !ok || !FastGetGoIDAvailable() {
+		return
+	}
+	if DetectedOffset() != known {
+		t.Errorf("detected offset %d, but the table says %d for %s", DetectedOffset(), known, runtime.Version())
+	}
+}
+
+func TestKnownOffsetFallback(t *testing.T) {
+	known, ok := KnownOffset(runtime.Version())
+	if !ok || !FastGetGoIDAvailable() {
+		t.Skip("no known offset for " + runtime.Version())
+	}
+	messages := captureLogf(t)
+	t.Cleanup(func() {
+		detectVoter = voteGidOffset
+		detectGidOffset()
+	})
+
+	// A failed vote falls back to the known offset
+	detectVoter = func() []int {
+		return nil
+	}
+	if offset := detectGidOffset(); offset != known {
+		t.Errorf("detectGidOffset() = %d after a failed vote, expected the known offset %d", offset, known)
+	}
+	if m := messages(); len(m) == 0 {
+		t.Errorf("expected the fallback to be logged")
+	}
+	if _, _, err := DetectionReport(); err != nil {
+		t.Errorf("expected no detection error after the fallback, got %v", err)
+	}
+
+	// A mismatch is reported, but the detected offset wins
+	if offset := checkKnownOffset(known + gidSize); offset != known+gidSize {
+		t.Errorf("checkKnownOffset(%d) = %d, expected the detected offset", known+gidSize, offset)
+	}
+}
@@ -0,0 +1,211 @@
+package goid
+
+import "sync"
+
+// localShardCount is the number of shards of a Local. Goroutine ids are handed
+// out sequentially, so consecutive goroutines land on different shards.
+const localShardCount = 64
+
+// Local is goroutine-local storage of a value of type T, keyed by the current
+// goroutine id. The zero value is ready to use.
+//
+// Entries are not reclaimed automatically when a goroutine exits. Call Delete
+// before the goroutine returns, or the entry leaks, or see AutoLocal.
+// Goroutines of worker pools, which outlive their tasks, should call
+// ResetLocals between tasks, so that a task doesn't see the values of the
+// previous one.
+type Local[T any] struct {
+	shards [localShardCount]localShard[T]
+}
+
+type localShard[T any] struct {
+	mu     sync.Mutex
+	values map[GoID]T
+	_      [48]byte // Keep shards on separate cache lines
+}
+
+func (l *Local[T]) shard(id GoID) *localShard[T] {
+	return &l.shards[uint64(id)%localShardCount]
+}
+
+// Get returns the value of the current goroutine, and whether it has one
+func (l *Local[T]) Get() (T, bool) {
+	return l.get(GetGoID())
+}
+
+// Set sets the value of the current goroutine
+func (l *Local[T]) Set(v T) {
+	l.set(GetGoID(), v)
+}
+
+// Delete removes the value of the current goroutine
+func (l *Local[T]) Delete() {
+	l.delete(GetGoID())
+}
+
+func (l *Local[T]) get(id GoID) (T, bool) {
+	s := l.shard(id)
+	s.mu.Lock()
+	v, ok := s.values[id]
+	s.mu.Unlock()
+	return v, ok
+}
+
+func (l *Local[T]) set(id GoID, v T) {
+	s := l.shard(id)
+	s.mu.Lock()
+	if s.values == nil {
+		s.values = make(map[GoID]T)
+	}
+	_, existed := s.values[id]
+	s.values[id] = v
+	s.mu.Unlock()
+	if !existed {
+		indexLocal(id, l)
+	}
+}
+
+func (l *Local[T]) delete(id GoID) {
+	if l.deleteValue(id) {
+		unindexLocal(id, l)
+	}
+}
+
+// deleteValue deletes the value of goroutine id, without updating the index of
+// locals, and tells whether there was one
+func (l *Local[T]) deleteValue(id GoID) bool {
+	s := l.shard(id)
+	s.mu.Lock()
+	_, existed := s.values[id]
+	delete(s.values, id)
+	s.mu.Unlock()
+	return existed
+}
+
+// len returns the number of goroutines with a value
+func (l *Local[T]) len() int {
+	n := 0
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		n += len(s.values)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// capture returns a function which sets the value of goroutine id, as of now,
+// on another goroutine, or nil if goroutine id has no value
+func (l *Local[T]) capture(id GoID) func(to GoID) {
+	v, ok := l.get(id)
+	if !ok {
+		return nil
+	}
+	return func(to GoID) {
+		l.set(to, v)
+	}
+}
+
+// local is the type-erased view of a Local, for Go and ResetLocals
+type local interface {
+	capture(id GoID) func(to GoID)
+	deleteValue(id GoID) bool
+}
+
+// localIndex tracks which Locals hold a value of each goroutine, so that Go
+// and ResetLocals only visit those. A Local drops out of the index once it
+// holds no value, so it can be garbage collected.
+var localIndex [localShardCount]localIndexShard
+
+type localIndexShard struct {
+	mu     sync.Mutex
+	locals map[GoID][]local
+	_      [48]byte // Keep shards on separate cache lines
+}
+
+func localIndexShardOf(id GoID) *localIndexShard {
+	return &localIndex[uint64(id)%localShardCount]
+}
+
+// indexLocal records that l holds a value of goroutine id
+func indexLocal(id GoID, l local) {
+	s := localIndexShardOf(id)
+	s.mu.Lock()
+	if s.locals == nil {
+		s.locals = make(map[GoID][]local)
+	}
+	s.locals[id] = append(s.locals[id], l)
+	s.mu.Unlock()
+}
+
+// unindexLocal records that l no longer holds a value of goroutine id
+func unindexLocal(id GoID, l local) {
+	s := localIndexShardOf(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ls := s.locals[id]
+	for i := range ls {
+		if ls[i] == l {
+			ls[i] = ls[len(ls)-1]
+			ls[len(ls)-1] = nil
+			ls = ls[:len(ls)-1]
+			break
+		}
+	}
+	if len(ls) == 0 {
+		delete(s.locals, id)
+	} else {
+		s.locals[id] = ls
+	}
+}
+
+// indexedLocals returns the Locals holding a value of goroutine id
+func indexedLocals(id GoID) []local {
+	s := localIndexShardOf(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]local(nil), s.locals[id]...)
+}
+
+// ResetLocals deletes the values of the current goroutine from every Local and
+// AutoLocal at once. It is the recommended way for worker pools, whose
+// goroutines run many tasks, to keep values from leaking from one task into
+// the next: call it between tasks.
+func ResetLocals() {
+	resetLocals(GetGoID())
+}
+
+// resetLocals deletes the values of goroutine id from every Local
+func resetLocals(id GoID) {
+	s := localIndexShardOf(id)
+	s.mu.Lock()
+	ls := s.locals[id]
+	delete(s.locals, id)
+	s.mu.Unlock()
+	for _, l := range ls {
+		l.deleteValue(id)
+	}
+}
+
+// Go runs fn in a new goroutine, which starts out with the values of every
+// Local of the current goroutine, as of the call to Go. Once fn returns or
+// panics, every value of the new goroutine is deleted, including the ones fn
+// set. Nested calls to Go compose.
+func Go(fn func()) {
+	parent := GetGoID()
+	var values []func(to GoID)
+	for _, l := range indexedLocals(parent) {
+		if set := l.capture(parent); set != nil {
+			values = append(values, set)
+		}
+	}
+
+	go func() {
+		id := GetGoID()
+		defer resetLocals(id)
+		for _, set := range values {
+			set(id)
+		}
+		fn()
+	}()
+}
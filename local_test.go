@@ -0,0 +1,166 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	var l Local[string]
+	if v, ok := l.Get(); ok {
+		t.Fatalf("expected no value, got %q", v)
+	}
+
+	l.Set("a")
+	l.Set("b")
+	if v, ok := l.Get(); !ok || v != "b" {
+		t.Errorf("Get() = %q, %v; expected \"b\", true", v, ok)
+	}
+
+	// Values are isolated to their goroutine
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer l.Delete()
+			if v, ok := l.Get(); ok {
+				t.Errorf("value %q leaked into another goroutine", v)
+			}
+			s := string(rune('A' + i%26))
+			l.Set(s)
+			if v, ok := l.Get(); !ok || v != s {
+				t.Errorf("Get() = %q, %v; expected %q, true", v, ok, s)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v, ok := l.Get(); !ok || v != "b" {
+		t.Errorf("other goroutines changed the value to %q, %v", v, ok)
+	}
+
+	l.Delete()
+	if v, ok := l.Get(); ok {
+		t.Errorf("expected no value after Delete(), got %q", v)
+	}
+	for i := range l.shards {
+		if n := len(l.shards[i].values); n != 0 {
+			t.Errorf("shard %d still holds %d values", i, n)
+		}
+	}
+}
+
+func TestGo(t *testing.T) {
+	var traceID Local[string]
+	var depth Local[int]
+	traceID.Set("t1")
+	defer traceID.Delete()
+
+	type result struct {
+		traceID string
+		ok      bool
+		depth   int
+	}
+	done := make(chan result, 2)
+	Go(func() {
+		id, ok := traceID.Get()
+		d, _ := depth.Get()
+		done <- result{id, ok, d}
+
+		// Nested calls compose
+		depth.Set(1)
+		Go(func() {
+			id, ok := traceID.Get()
+			d, _ := depth.Get()
+			done <- result{id, ok, d}
+		})
+	})
+	// Later changes in the parent don't affect children
+	traceID.Set("t2")
+
+	for i := 0; i < 2; i++ {
+		if r := <-done; !r.ok || r.traceID != "t1" || r.depth != i {
+			t.Errorf("child %d observed %q, %v, depth %d; expected \"t1\", true, depth %d",
+				i, r.traceID, r.ok, r.depth, i)
+		}
+	}
+
+	// Values are deleted from children, even when fn doesn't return normally
+	exited := make(chan struct{})
+	Go(func() {
+		defer close(exited)
+		runtime.Goexit()
+	})
+	<-exited
+	deadline := time.Now().Add(5 * time.Second)
+	for traceID.len() > 1 || depth.len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("values of children were not deleted: %d trace ids, %d depths",
+				traceID.len(), depth.len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := traceID.Get(); v != "t2" {
+		t.Errorf("children changed the value of the parent to %q", v)
+	}
+}
+
+func TestResetLocals(t *testing.T) {
+	var user Local[string]
+	var attempts AutoLocal[int]
+	defer ResetLocals()
+
+	// A worker runs two tasks on the same goroutine
+	tasks := []func() (string, bool, int, bool){
+		func() (string, bool, int, bool) {
+			user.Set("alice")
+			attempts.Set(3)
+			u, uok := user.Get()
+			a, aok := attempts.Get()
+			return u, uok, a, aok
+		},
+		func() (string, bool, int, bool) {
+			u, uok := user.Get()
+			a, aok := attempts.Get()
+			return u, uok, a, aok
+		},
+	}
+	u, uok, a, aok := tasks[0]()
+	if !uok || u != "alice" || !aok || a != 3 {
+		t.Fatalf("first task observed %q, %v, %d, %v", u, uok, a, aok)
+	}
+	ResetLocals()
+	if u, uok, a, aok := tasks[1](); uok || aok {
+		t.Errorf("second task observed the values of the first: %q, %d", u, a)
+	}
+	if n := len(indexedLocals(GetGoID())); n != 0 {
+		t.Errorf("expected no indexed locals after ResetLocals, got %d", n)
+	}
+
+	// Delete keeps the index in sync
+	user.Set("bob")
+	user.Set("carol")
+	if n := len(indexedLocals(GetGoID())); n != 1 {
+		t.Errorf("expected 1 indexed local, got %d", n)
+	}
+	user.Delete()
+	if n := len(indexedLocals(GetGoID())); n != 0 {
+		t.Errorf("expected no indexed locals after Delete, got %d", n)
+	}
+}
+
+func BenchmarkLocal(b *testing.B) {
+	var l Local[int]
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		defer l.Delete()
+		for i := 0; pb.Next(); i++ {
+			l.Set(i)
+			if _, ok := l.Get(); !ok {
+				b.Fatal("value not found")
+			}
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package goid
+
+// Logf, if set, is called to report notable events: the outcome of offset
+// detection, mismatches caught by GetGoIDChecked and the fast path being
+// disabled by the offset monitor. It is nil by default, which costs nothing.
+// Set it before using the package, as it is read without synchronization.
+//
+// It complements the hooks of OnDetectTimeout, OnCheckMismatch and
+// OnOffsetDrift, which keep reporting as before.
+var Logf func(format string, args ...interface{})
+
+// logf calls Logf, if set
+func logf(format string, args ...interface{}) {
+	if Logf != nil {
+		Logf(format, args...)
+	}
+}
@@ -0,0 +1,50 @@
+package goid
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogf sets Logf to record messages for the duration of a test, and
+// returns a function returning the messages so far
+func captureLogf(t *testing.T) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var messages []string
+	Logf = func(format string, args ...interface{}) {
+		mu.Lock()
+		messages = append(messages, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+	t.Cleanup(func() {
+		Logf = nil
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), messages...)
+	}
+}
+
+func TestLogf(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	t.Cleanup(func() {
+		detectGidOffset()
+	})
+	messages := captureLogf(t)
+
+	detectGidOffset()
+	if m := messages(); len(m) != 1 || !strings.Contains(m[0], fmt.Sprintf("at offset %d", DetectedOffset())) {
+		t.Errorf("expected a message telling the offset found, got %q", m)
+	}
+
+	fakeGoroutinePrefix(t)
+	detectGidOffset()
+	if m := messages(); len(m) != 2 || !strings.Contains(m[1], "offset detection failed") {
+		t.Errorf("expected a message telling detection failed, got %q", m)
+	}
+}
@@ -0,0 +1,40 @@
+package goid
+
+// mdcs holds the mapped diagnostic context of each goroutine. The stored maps
+// are never mutated in place, so they can be shared with the goroutines
+// started by Go.
+var mdcs AutoLocal[map[string]string]
+
+// PutMDC sets key to value in the mapped diagnostic context (MDC) of the
+// current goroutine. Loggers can then pull the contextual fields of the
+// current goroutine via MDC, without them being threaded through. Goroutines
+// started by Go inherit the MDC of their parent.
+func PutMDC(key, value string) {
+	old, _ := mdcs.Get()
+	mdc := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		mdc[k] = v
+	}
+	mdc[key] = value
+	mdcs.Set(mdc)
+}
+
+// MDC returns a copy of the mapped diagnostic context of the current
+// goroutine, or nil if it has none
+func MDC() map[string]string {
+	old, ok := mdcs.Get()
+	if !ok {
+		return nil
+	}
+	mdc := make(map[string]string, len(old))
+	for k, v := range old {
+		mdc[k] = v
+	}
+	return mdc
+}
+
+// ClearMDC removes the mapped diagnostic context of the current goroutine. It
+// is also removed once the goroutine exits, see OnExit.
+func ClearMDC() {
+	mdcs.Delete()
+}
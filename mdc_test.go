@@ -0,0 +1,57 @@
+package goid
+
+import "testing"
+
+func TestMDC(t *testing.T) {
+	defer ClearMDC()
+	if mdc := MDC(); mdc != nil {
+		t.Fatalf("expected no MDC, got %v", mdc)
+	}
+
+	PutMDC("request_id", "r1")
+	PutMDC("user_id", "u1")
+	PutMDC("request_id", "r2")
+	mdc := MDC()
+	if len(mdc) != 2 || mdc["request_id"] != "r2" || mdc["user_id"] != "u1" {
+		t.Fatalf("unexpected MDC %v", mdc)
+	}
+
+	// The returned map is a copy
+	mdc["user_id"] = "u2"
+	if MDC()["user_id"] != "u1" {
+		t.Errorf("modifying the result of MDC() changed the MDC")
+	}
+
+	// The MDC is isolated to this goroutine
+	done := make(chan map[string]string)
+	go func() {
+		defer ClearMDC()
+		before := MDC()
+		PutMDC("request_id", "other")
+		done <- before
+	}()
+	if other := <-done; other != nil {
+		t.Errorf("MDC leaked into another goroutine: %v", other)
+	}
+	if MDC()["request_id"] != "r2" {
+		t.Errorf("another goroutine's PutMDC changed this goroutine's MDC")
+	}
+
+	// Goroutines started by Go inherit the MDC, but changes don't flow back
+	Go(func() {
+		before := MDC()
+		PutMDC("request_id", "child")
+		done <- before
+	})
+	if inherited := <-done; len(inherited) != 2 || inherited["request_id"] != "r2" {
+		t.Errorf("expected the child to inherit the MDC, got %v", inherited)
+	}
+	if MDC()["request_id"] != "r2" {
+		t.Errorf("the child's PutMDC changed the parent's MDC")
+	}
+
+	ClearMDC()
+	if mdc := MDC(); mdc != nil {
+		t.Errorf("expected no MDC after ClearMDC, got %v", mdc)
+	}
+}
@@ -0,0 +1,122 @@
+package goid
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	monitorMu      sync.Mutex
+	monitorStop    chan struct{} // Closed to stop the running monitor, if any
+	monitorDone    chan struct{} // Closed once the running monitor exited
+	monitorChecks  int64         // Number of checks run by the monitor
+	monitorFastGid = fastGid     // fastGid, as used by the monitor
+	driftMu        sync.Mutex
+	driftHook      func(fast, slow GoID) = logDrift
+)
+
+// StartOffsetMonitor starts a background goroutine which, every interval,
+// spawns a goroutine and compares the fast path against the slow path in it.
+// If they disagree, the fast path is disabled process-wide, so that GetGoID
+// and FastGetGoIDAvailable fall back to the slow path, the drift is reported,
+// see OnOffsetDrift, and the monitor exits. This guards long-running
+// processes against an offset which matched by coincidence during detection.
+//
+// Starting the monitor again replaces the running one. Panics if interval is
+// not positive.
+func StartOffsetMonitor(interval time.Duration) {
+	if interval <= 0 {
+		panic("goid: non-positive offset monitor interval")
+	}
+	monitorMu.Lock()
+	defer monitorMu.Unlock()
+	stopOffsetMonitor()
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	monitorStop, monitorDone = stop, done
+	go runOffsetMonitor(interval, stop, done)
+}
+
+// StopOffsetMonitor stops the monitor started by StartOffsetMonitor, and waits
+// for its goroutine to exit. It is a no-op if no monitor is running.
+func StopOffsetMonitor() {
+	monitorMu.Lock()
+	defer monitorMu.Unlock()
+	stopOffsetMonitor()
+}
+
+// stopOffsetMonitor is StopOffsetMonitor, with monitorMu held
+func stopOffsetMonitor() {
+	if monitorStop == nil {
+		return
+	}
+	close(monitorStop)
+	<-monitorDone
+	monitorStop, monitorDone = nil, nil
+}
+
+// OffsetMonitorChecks returns how many checks the offset monitor ran so far
+func OffsetMonitorChecks() int {
+	return int(atomic.LoadInt64(&monitorChecks))
+}
+
+// OnOffsetDrift registers fn to be invoked when the offset monitor catches the
+// fast path disagreeing with the slow path, replacing the default hook, which
+// logs a warning with the standard logger. A nil fn disables reporting.
+func OnOffsetDrift(fn func(fast, slow GoID)) {
+	driftMu.Lock()
+	driftHook = fn
+	driftMu.Unlock()
+}
+
+func logDrift(fast, slow GoID) {
+	log.Printf("goid: fast path returned goroutine id %d instead of %d, "+
+		"disabling the fast path", fast, slow)
+}
+
+func runOffsetMonitor(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !fastPathEnabled || !FastGetGoIDAvailable() {
+			continue
+		}
+		if fast, slow := checkOffsetDrift(); fast != slow {
+			setFastPathDisabled(disabledByDrift, true)
+			logf("goid: offset monitor caught the fast path returning %d instead of %d, "+
+				"disabling the fast path", fast, slow)
+			driftMu.Lock()
+			hook := driftHook
+			driftMu.Unlock()
+			if hook != nil {
+				hook(fast, slow)
+			}
+			return
+		}
+	}
+}
+
+// checkOffsetDrift returns the ids from the fast and the slow path in a new
+// goroutine. They are equal if the slow path fails, which proves nothing.
+func checkOffsetDrift() (fast, slow GoID) {
+	type ids struct{ fast, slow GoID }
+	ch := make(chan ids)
+	go func() {
+		fast, slow := monitorFastGid(), slowGid()
+		if slow == 0 {
+			slow = fast
+		}
+		ch <- ids{fast, slow}
+	}()
+	got := <-ch
+	atomic.AddInt64(&monitorChecks, 1)
+	return got.fast, got.slow
+}
@@ -0,0 +1,89 @@
+package goid
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitMonitorChecks waits until the offset monitor ran n more checks than
+// before, failing the test after a while
+func waitMonitorChecks(t *testing.T, before, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for OffsetMonitorChecks() < before+n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d monitor checks, got %d", n, OffsetMonitorChecks()-before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOffsetMonitor(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	var drifts int32
+	OnOffsetDrift(func(fast, slow GoID) {
+		atomic.AddInt32(&drifts, 1)
+	})
+	defer OnOffsetDrift(logDrift)
+
+	goroutines := runtime.NumGoroutine()
+	before := OffsetMonitorChecks()
+	StartOffsetMonitor(time.Millisecond)
+	StartOffsetMonitor(time.Millisecond) // Replaces the running monitor
+	waitMonitorChecks(t, before, 5)
+	StopOffsetMonitor()
+	StopOffsetMonitor() // No-op
+
+	if n := atomic.LoadInt32(&drifts); n != 0 {
+		t.Errorf("expected no drift under normal conditions, got %d", n)
+	}
+	if !FastGetGoIDAvailable() {
+		t.Errorf("expected the fast path to remain available")
+	}
+	// The goroutine of the last check may take a moment to exit after
+	// reporting
+	for try := 0; runtime.NumGoroutine() > goroutines; try++ {
+		if try == 1000 {
+			t.Fatalf("expected %d goroutines after stopping the monitor, got %d",
+				goroutines, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOffsetMonitorDrift(t *testing.T) {
+	if !FastGetGoIDAvailable() {
+		t.Skip("fast path not available")
+	}
+	drifts := make(chan GoID, 1)
+	OnOffsetDrift(func(fast, slow GoID) {
+		drifts <- fast
+	})
+	monitorFastGid = func() GoID { return -1 }
+	defer func() {
+		StopOffsetMonitor()
+		OnOffsetDrift(logDrift)
+		monitorFastGid = fastGid
+		setFastPathDisabled(disabledByDrift, false)
+	}()
+
+	StartOffsetMonitor(time.Millisecond)
+	select {
+	case fast := <-drifts:
+		if fast != -1 {
+			t.Errorf("expected the drift to report fast id -1, got %d", fast)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the monitor to report a drift")
+	}
+	if FastGetGoIDAvailable() {
+		t.Errorf("expected the fast path to be disabled after a drift")
+	}
+	if GetGoID() != slowGid() {
+		t.Errorf("expected GetGoID to fall back to the slow path")
+	}
+}
@@ -0,0 +1,46 @@
+package goid
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// OwnerTracker records which goroutine claims ownership of a resource, for
+// diagnostics such as "which goroutine is holding this connection right now".
+// Unlike a mutex it never blocks. The zero value tracks no owner.
+type OwnerTracker struct {
+	owner int64 // The owning GoID, 0 if none. First for 64-bit alignment.
+
+	// Strict makes Acquire panic when another goroutine already owns the
+	// resource. Otherwise Acquire takes over ownership.
+	Strict bool
+}
+
+// Acquire records the current goroutine as the owner
+func (o *OwnerTracker) Acquire() {
+	id := GetGoID()
+	if !o.Strict {
+		atomic.StoreInt64(&o.owner, int64(id))
+		return
+	}
+	for {
+		owner := atomic.LoadInt64(&o.owner)
+		if owner != 0 && owner != int64(id) {
+			panic(fmt.Sprintf("goid: goroutine %d acquired resource owned by goroutine %d", id, owner))
+		}
+		if atomic.CompareAndSwapInt64(&o.owner, owner, int64(id)) {
+			return
+		}
+	}
+}
+
+// Owner returns the id of the owning goroutine, if any
+func (o *OwnerTracker) Owner() (GoID, bool) {
+	owner := atomic.LoadInt64(&o.owner)
+	return GoID(owner), owner != 0
+}
+
+// Release clears the owner
+func (o *OwnerTracker) Release() {
+	atomic.StoreInt64(&o.owner, 0)
+}
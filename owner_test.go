@@ -0,0 +1,66 @@
+package goid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOwnerTracker(t *testing.T) {
+	var o OwnerTracker
+	if _, ok := o.Owner(); ok {
+		t.Fatalf("zero OwnerTracker has an owner")
+	}
+
+	o.Acquire()
+	if owner, ok := o.Owner(); !ok || owner != GetGoID() {
+		t.Errorf("Owner() = %d, %v; expected %d, true", owner, ok, GetGoID())
+	}
+
+	// Another goroutine takes over ownership
+	done := make(chan GoID)
+	go func() {
+		o.Acquire()
+		done <- GetGoID()
+	}()
+	other := <-done
+	if owner, ok := o.Owner(); !ok || owner != other {
+		t.Errorf("Owner() = %d, %v; expected %d, true", owner, ok, other)
+	}
+
+	o.Release()
+	if _, ok := o.Owner(); ok {
+		t.Errorf("OwnerTracker has an owner after Release")
+	}
+}
+
+func TestOwnerTrackerStrict(t *testing.T) {
+	o := OwnerTracker{Strict: true}
+	o.Acquire()
+	o.Acquire() // Reacquiring by the owner is fine
+
+	done := make(chan interface{})
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		o.Acquire()
+	}()
+	r := <-done
+	if msg, _ := r.(string); !strings.Contains(msg, "owned by goroutine") {
+		t.Errorf("expected Acquire by another goroutine to panic, recovered %v", r)
+	}
+	if owner, _ := o.Owner(); owner != GetGoID() {
+		t.Errorf("failed Acquire changed the owner to %d", owner)
+	}
+
+	o.Release()
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		o.Acquire()
+	}()
+	if r := <-done; r != nil {
+		t.Errorf("Acquire after Release panicked: %v", r)
+	}
+}
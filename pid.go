@@ -0,0 +1,184 @@
+package goid
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+const pSize = 256 // Number of bytes of the "p" scanned for fields
+
+var (
+	pidOnce   sync.Once
+	mPOffset  = -1 // Offset of the "p" pointer in the "m"
+	pIDOffset = -1 // Offset of the id in the "p"
+)
+
+// GetPID returns the id of the runtime "p", the processor the current goroutine
+// is running on, in [0, GOMAXPROCS). The goroutine may be moved to another P
+// right after the call. Returns false if the id could not be located, or if
+// the goroutine has no P.
+//
+// The "p" pointer in the "m", see GetThreadID, and the id in the "p" are
+// detected on the first call, and validated against threads locked by
+// runtime.LockOSThread. With the goid_safe build tag, it always returns false.
+func GetPID() (int32, bool) {
+	if !fastPathEnabled {
+		return 0, false
+	}
+	pidOnce.Do(func() {
+		mPOffset, pIDOffset = getPIDOffsets()
+	})
+	if pIDOffset < 0 {
+		return 0, false
+	}
+	m := wordFromG(getg(), gmOffset)
+	if m == 0 {
+		return 0, false
+	}
+	p := wordAt(m, mPOffset)
+	if p == 0 {
+		return 0, false
+	}
+	return int32At(p, pIDOffset), true
+}
+
+// pRead is what a voter of getPIDOffsets reads through one candidate offset of
+// the "p" pointer in its "m"
+type pRead struct {
+	p    uintptr // Address of the candidate "p"
+	back int     // Offset in the "p" which points back to the "m", or -1
+	ids  []int32 // Candidate ids, up to the back-link
+}
+
+// getPIDOffsets figures out the offset of the "p" pointer in the "m", and of
+// the id in the "p". Returns -1 for both if either can't be located.
+//
+// The "p" pointer lies between "m.curg" and the "m" id, and points to a
+// structure which points back to the "m". The id is the first int32 before the
+// back-link which is within [0, GOMAXPROCS) on all threads, and which tells
+// the "p"s of the threads apart.
+func getPIDOffsets() (pOffset, idOffset int) {
+	if _, ok := GetThreadID(); !ok {
+		return -1, -1
+	}
+	oldPanicOnFault := debug.SetPanicOnFault(true)
+	defer func() {
+		if r := recover(); r != nil {
+			pOffset, idOffset = -1, -1
+		}
+	}()
+	defer debug.SetPanicOnFault(oldPanicOnFault)
+
+	curg := findCurg(getg(), wordFromG(getg(), gmOffset))
+	if curg < 0 {
+		return -1, -1
+	}
+	start := curg + ptrSize
+	count := (mIDOffset - start) / ptrSize
+	if count <= 0 {
+		return -1, -1
+	}
+
+	snapshots := make(chan []pRead, threadVoters)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < threadVoters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			debug.SetPanicOnFault(true)
+			snapshots <- snapshotP(start, count)
+			// Keep the thread locked until all snapshots are taken, so
+			// that every voter runs on its own thread
+			<-release
+		}()
+	}
+	var votes [][]pRead
+	for i := 0; i < threadVoters; i++ {
+		if snapshot := <-snapshots; snapshot != nil {
+			votes = append(votes, snapshot)
+		}
+	}
+	close(release)
+	wg.Wait()
+	if len(votes) < threadVoters {
+		return -1, -1
+	}
+
+	procs := int32(runtime.GOMAXPROCS(0))
+	for i := 0; i < count; i++ {
+		back := votes[0][i].back
+		for _, vote := range votes {
+			if vote[i].back < 0 || vote[i].back != back {
+				back = -1
+				break
+			}
+		}
+		if back < 0 {
+			continue
+		}
+		if idOffset = findPIDOffset(votes, i, procs); idOffset >= 0 {
+			return start + i*ptrSize, idOffset
+		}
+	}
+	return -1, -1
+}
+
+// findPIDOffset returns the offset of the first int32 read through candidate
+// i which is within [0, procs) in all votes, the same for the same "p" and
+// distinct for distinct "p"s. Returns -1 if there is none.
+func findPIDOffset(votes [][]pRead, i int, procs int32) int {
+next:
+	for j := range votes[0][i].ids {
+		byP := make(map[uintptr]int32, len(votes))
+		seen := make(map[int32]bool, len(votes))
+		for _, vote := range votes {
+			read := vote[i]
+			id := read.ids[j]
+			if id < 0 || id >= procs {
+				continue next
+			}
+			if known, ok := byP[read.p]; ok {
+				if known != id {
+					continue next
+				}
+				continue
+			}
+			if seen[id] {
+				continue next
+			}
+			byP[read.p] = id
+			seen[id] = true
+		}
+		return j * 4
+	}
+	return -1
+}
+
+// snapshotP reads count candidate "p" pointers from the "m" of the current
+// goroutine, which must be locked to its thread, starting at offset start.
+// Returns nil if the "m" can't be read.
+func snapshotP(start, count int) (snapshot []pRead) {
+	defer func() {
+		if r := recover(); r != nil {
+			snapshot = nil
+		}
+	}()
+	m := wordFromG(getg(), gmOffset)
+	if m == 0 {
+		return nil
+	}
+	snapshot = make([]pRead, count)
+	for i := range snapshot {
+		p := wordAt(m, start+i*ptrSize)
+		read := pRead{p: p, back: findPointer(p, m, pSize)}
+		for offset := 0; offset < read.back; offset += 4 {
+			read.ids = append(read.ids, int32At(p, offset))
+		}
+		snapshot[i] = read
+	}
+	return snapshot
+}
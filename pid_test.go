@@ -0,0 +1,41 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestGetPID(t *testing.T) {
+	if !fastPathEnabled || getg() == nil {
+		if _, ok := GetPID(); ok {
+			t.Errorf("GetPID() succeeded without the fast path")
+		}
+		t.Skip("getg not available")
+	}
+	procs := int32(runtime.GOMAXPROCS(0))
+	check := func() {
+		id, ok := GetPID()
+		if !ok {
+			t.Errorf("GetPID failed to locate the P id")
+			return
+		}
+		if id < 0 || id >= procs {
+			t.Errorf("GetPID() = %d, expected it within [0, %d)", id, procs)
+		}
+	}
+	check()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				check()
+				runtime.Gosched()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,44 @@
+package goid
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoNewestGoID is returned when the id of a fresh goroutine can't be
+// determined
+var errNoNewestGoID = errors.New("goid: could not determine the id of a new goroutine")
+
+// newestGoID spawns a goroutine and returns its id. Since the runtime hands
+// out ids from an increasing counter, this approximates the total number of
+// goroutines created so far. Each P reserves ids in batches of 16, so the
+// approximation is off by up to 16 ids per P.
+func newestGoID() GoID {
+	ret := make(chan GoID)
+	go func() {
+		ret <- GetGoID()
+	}()
+	return <-ret
+}
+
+// CreationRate estimates how many goroutines are created per second, by
+// sampling the id of a freshly spawned goroutine at two points window apart.
+// It blocks for window. The estimate is coarse for short windows, since ids
+// are reserved in batches.
+func CreationRate(window time.Duration) (float64, error) {
+	start := time.Now()
+	first := newestGoID()
+	time.Sleep(window)
+	last := newestGoID()
+	elapsed := time.Since(start)
+
+	if first <= 0 || last <= 0 {
+		return 0, errNoNewestGoID
+	}
+	// The sampling goroutines themselves don't count
+	created := float64(last - first - 1)
+	if created < 0 {
+		created = 0
+	}
+	return created / elapsed.Seconds(), nil
+}
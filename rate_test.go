@@ -0,0 +1,47 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreationRate(t *testing.T) {
+	const (
+		window = 200 * time.Millisecond
+		count  = 20000
+	)
+
+	// Spawn count goroutines during the window
+	var wg sync.WaitGroup
+	wg.Add(count)
+	go func() {
+		time.Sleep(window / 10)
+		for i := 0; i < count; i++ {
+			go wg.Done()
+		}
+	}()
+	rate, err := CreationRate(window)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("CreationRate failed: %v", err)
+	}
+
+	// Allow for ids reserved in batches by each P, and for other goroutines
+	slack := float64(64 * runtime.GOMAXPROCS(0))
+	expected := count / window.Seconds()
+	if rate < 0.5*expected || rate > (count+slack)/window.Seconds() {
+		t.Errorf("CreationRate() = %.0f/s, expected about %.0f/s", rate, expected)
+	}
+}
+
+func TestCreationRateIdle(t *testing.T) {
+	rate, err := CreationRate(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("CreationRate failed: %v", err)
+	}
+	if rate < 0 {
+		t.Errorf("CreationRate() = %f, expected a non-negative rate", rate)
+	}
+}
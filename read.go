@@ -0,0 +1,57 @@
+//go:build !goid_safe
+
+package goid
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// gidFromG casts the value at `g + offset` to a GoID
+//
+// Reading the "g" of the current goroutine is always safe: the goroutine is
+// running, so its "g" can't be released, and the runtime never frees a "g"
+// anyway but keeps exited ones on a free list for reuse. Even a preemption
+// between getg() and the read leaves the goroutine on the same "g".
+//
+//go:nocheckptr
+func gidFromG(g *g, offset int) GoID {
+	return *(*GoID)(unsafe.Pointer(uintptr(unsafe.Pointer(g)) + uintptr(offset)))
+}
+
+// statusFromG atomically loads the uint32 at `g + offset`
+//
+//go:nocheckptr
+func statusFromG(g *g, offset int) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Pointer(uintptr(unsafe.Pointer(g)) + uintptr(offset))))
+}
+
+// wordFromG loads the word at `g + offset`
+//
+//go:nocheckptr
+func wordFromG(g *g, offset int) uintptr {
+	return *(*uintptr)(unsafe.Pointer(uintptr(unsafe.Pointer(g)) + uintptr(offset)))
+}
+
+// wordAt loads the word at `base + offset`, where base is an address read out
+// of a runtime structure. Runtime structures such as the "m" are never freed
+// while their thread runs, so the address stays valid.
+//
+//go:nocheckptr
+func wordAt(base uintptr, offset int) uintptr {
+	return *(*uintptr)(unsafe.Add(unsafe.Pointer(nil), base+uintptr(offset)))
+}
+
+// int64At loads the int64 at `base + offset`, see wordAt
+//
+//go:nocheckptr
+func int64At(base uintptr, offset int) int64 {
+	return *(*int64)(unsafe.Add(unsafe.Pointer(nil), base+uintptr(offset)))
+}
+
+// int32At loads the int32 at `base + offset`, see wordAt
+//
+//go:nocheckptr
+func int32At(base uintptr, offset int) int32 {
+	return *(*int32)(unsafe.Add(unsafe.Pointer(nil), base+uintptr(offset)))
+}
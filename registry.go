@@ -0,0 +1,35 @@
+package goid
+
+import "sync"
+
+// Registry names goroutines, e.g. for profiling. The zero value is ready to
+// use.
+type Registry struct {
+	names sync.Map // GoID to name
+	watch exitWatch
+}
+
+// Register names the current goroutine, replacing any previous name. The name
+// is removed once the goroutine exits, see OnExit, so that names of dead
+// goroutines don't leak. As with OnExit, this happens with some delay.
+func (r *Registry) Register(name string) {
+	id := GetGoID()
+	r.names.Store(id, name)
+	r.watch.watch(id, func() {
+		r.names.Delete(id)
+	})
+}
+
+// Name returns the name of the goroutine with the given id, and whether it has
+// one
+func (r *Registry) Name(id GoID) (string, bool) {
+	if name, ok := r.names.Load(id); ok {
+		return name.(string), true
+	}
+	return "", false
+}
+
+// Unregister removes the name of the current goroutine
+func (r *Registry) Unregister() {
+	r.names.Delete(GetGoID())
+}
@@ -0,0 +1,59 @@
+package goid
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	fastExitPolling(t)
+	var r Registry
+
+	r.Register("main")
+	r.Register("test")
+	if name, ok := r.Name(GetGoID()); !ok || name != "test" {
+		t.Errorf("Name() = %q, %v; expected \"test\", true", name, ok)
+	}
+	r.Unregister()
+	if name, ok := r.Name(GetGoID()); ok {
+		t.Errorf("Name() = %q, true after Unregister()", name)
+	}
+
+	const n = 10
+	ids := make(chan GoID, n)
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			r.Register(fmt.Sprintf("worker-%d", i))
+			ids <- GetGoID()
+			<-release
+		}(i)
+	}
+	workers := make([]GoID, n)
+	for i := range workers {
+		workers[i] = <-ids
+	}
+	for _, id := range workers {
+		if name, ok := r.Name(id); !ok || len(name) < len("worker-") {
+			t.Errorf("Name(%d) = %q, %v; expected a worker name", id, name, ok)
+		}
+	}
+
+	// Names disappear once the goroutines exited
+	close(release)
+	runtime.GC()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range workers {
+		for {
+			if _, ok := r.Name(id); !ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("name of goroutine %d not removed after it exited", id)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build goid_safe
+
+package goid
+
+import "testing"
+
+func TestSafeBuild(t *testing.T) {
+	if FastGetGoIDAvailable() {
+		t.Errorf("FastGetGoIDAvailable() = true with the goid_safe build tag")
+	}
+	// Even the unchecked fast path falls back to the slow path
+	if id := GetGoIDUnsafe(); id != slowGid() {
+		t.Errorf("GetGoIDUnsafe() = %d, expected %d", id, slowGid())
+	}
+	done := make(chan GoID)
+	go func() {
+		done <- GetGoIDUnsafe() - slowGid()
+	}()
+	if diff := <-done; diff != 0 {
+		t.Errorf("GetGoIDUnsafe() is off by %d in a spawned goroutine", diff)
+	}
+}
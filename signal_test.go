@@ -0,0 +1,38 @@
+//go:build linux || darwin
+
+package goid
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGetGoIDInSignalGoroutine(t *testing.T) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+
+	type result struct{ before, after, slow GoID }
+	results := make(chan result)
+	go func() {
+		before := GetGoID()
+		<-sigCh
+		results <- result{before, GetGoID(), slowGid()}
+	}()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("failed to send SIGUSR1: %v", err)
+	}
+	select {
+	case r := <-results:
+		if r.after <= 0 || r.after != r.before || r.after != r.slow {
+			t.Errorf("GetGoID() = %d after the signal, %d before, slowGid() = %d",
+				r.after, r.before, r.slow)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("signal was not delivered")
+	}
+}
@@ -0,0 +1,119 @@
+package goid
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// GroupBySyncObject groups the live goroutines which are blocked on a sync
+// primitive or channel by the object they are blocked on, revealing clusters
+// of goroutines contending for, or deadlocked on, the same object.
+//
+// When the top frames of a goroutine show the address of the object, as in
+// "sync.(*Mutex).lockSlow(0xc000012345)", the key is that frame's function and
+// address. Arguments are often elided or unreliable in stack dumps though, so
+// otherwise the key is the state and the location of the first frame outside
+// of package runtime and sync, as in "chan receive at /src/main.go:23", which
+// groups goroutines blocked at the same place. Goroutines which aren't
+// blocked on a sync primitive or channel are left out. The ids of each group
+// are sorted in ascending order.
+func GroupBySyncObject() (groups map[string][]GoID, err error) {
+	withDump(func(dump []byte) {
+		var ok bool
+		if groups, ok = groupBySyncObject(dump); !ok {
+			err = ErrDumpUnparsable
+		}
+	})
+	return groups, err
+}
+
+// groupBySyncObject implements GroupBySyncObject on dump. Returns false if no
+// goroutine could be parsed.
+func groupBySyncObject(dump []byte) (map[string][]GoID, bool) {
+	groups := make(map[string][]GoID)
+	ok := forEachGoroutine(dump, func(id GoID, block []byte) bool {
+		if key := syncObjectKey(block); key != "" {
+			groups[key] = append(groups[key], id)
+		}
+		return true
+	})
+	for _, ids := range groups {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return groups, ok
+}
+
+// syncObjectKey returns the key under which GroupBySyncObject groups the
+// goroutine of the given block, or an empty string if it isn't blocked on a
+// sync primitive or channel
+func syncObjectKey(block []byte) string {
+	state := parseGoroutineState(block)
+	if !isSyncState(state) {
+		return ""
+	}
+
+	lines := strings.Split(string(bytes.TrimSuffix(block, []byte("\n"))), "\n")
+	for i := 1; i+1 < len(lines); i += 2 {
+		frame, location := lines[i], strings.TrimSpace(lines[i+1])
+		if strings.HasPrefix(frame, "created by ") {
+			break
+		}
+		function, args := splitFrame(frame)
+		if !isSyncFunction(function) {
+			if end := strings.LastIndex(location, " +0x"); end >= 0 {
+				location = location[:end]
+			}
+			return state + " at " + location
+		}
+		if addr := firstAddress(args); addr != "" {
+			return function + "(" + addr + ")"
+		}
+	}
+	return ""
+}
+
+// isSyncState tells if state is that of a goroutine blocked on a sync
+// primitive or channel
+func isSyncState(state string) bool {
+	return strings.HasPrefix(state, "sync.") ||
+		strings.HasPrefix(state, "semacquire") ||
+		strings.HasPrefix(state, "chan send") ||
+		strings.HasPrefix(state, "chan receive")
+}
+
+// isSyncFunction tells if function belongs to the implementation of sync
+// primitives or channels
+func isSyncFunction(function string) bool {
+	return strings.HasPrefix(function, "sync.") ||
+		strings.HasPrefix(function, "internal/sync.") ||
+		strings.HasPrefix(function, "runtime.")
+}
+
+// splitFrame splits a "pkg.fn(0x1, 0x2)" frame line into its function and its
+// arguments
+func splitFrame(frame string) (function string, args []string) {
+	start := strings.LastIndexByte(frame, '(')
+	end := strings.LastIndexByte(frame, ')')
+	if start < 0 || end < start {
+		return frame, nil
+	}
+	if argList := frame[start+1 : end]; argList != "" {
+		args = strings.Split(argList, ", ")
+	}
+	return frame[:start], args
+}
+
+// firstAddress returns the first argument if it is a reliable, non-nil
+// address. Dumps mark unreliable arguments with a trailing '?' and elide those
+// of inlined frames as "...".
+func firstAddress(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	arg := args[0]
+	if !strings.HasPrefix(arg, "0x") || strings.HasSuffix(arg, "?") || arg == "0x0" {
+		return ""
+	}
+	return arg
+}
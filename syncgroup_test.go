@@ -0,0 +1,124 @@
+package goid
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const syncDump = `goroutine 1 [running]:
+main.main()
+	/src/main.go:27 +0x21d
+
+goroutine 6 [sync.Mutex.Lock]:
+internal/sync.runtime_SemacquireMutex(0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+internal/sync.(*Mutex).lockSlow(0xc0000a6000)
+	/usr/local/go/src/internal/sync/mutex.go:149 +0x15a
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.worker()
+	/src/main.go:20 +0x2c
+created by main.main in goroutine 1
+	/src/main.go:19 +0x116
+
+goroutine 7 [semacquire, 3 minutes]:
+sync.runtime_Semacquire(0xc0000a6000)
+	/usr/local/go/src/runtime/sema.go:62 +0x25
+main.other()
+	/src/main.go:40 +0x2c
+
+goroutine 8 [sync.Mutex.Lock]:
+internal/sync.runtime_SemacquireMutex(0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+internal/sync.(*Mutex).lockSlow(0xc0000a6000)
+	/usr/local/go/src/internal/sync/mutex.go:149 +0x15a
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.worker()
+	/src/main.go:20 +0x2c
+created by main.main in goroutine 1
+	/src/main.go:19 +0x116
+
+goroutine 9 [sync.Mutex.Lock]:
+internal/sync.runtime_SemacquireMutex(0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+internal/sync.(*Mutex).lockSlow(0xc0000b8000)
+	/usr/local/go/src/internal/sync/mutex.go:149 +0x15a
+main.worker()
+	/src/main.go:20 +0x2c
+
+goroutine 10 [chan receive]:
+main.consumer()
+	/src/main.go:23 +0x19
+created by main.main in goroutine 1
+	/src/main.go:22 +0xb2
+
+goroutine 11 [chan receive, 1 minutes]:
+main.consumer()
+	/src/main.go:23 +0x19
+created by main.main in goroutine 1
+	/src/main.go:22 +0xb2
+
+goroutine 12 [select]:
+main.selector()
+	/src/main.go:30 +0x19
+`
+
+func TestGroupBySyncObjectSynthetic(t *testing.T) {
+	groups, ok := groupBySyncObject([]byte(syncDump))
+	if !ok {
+		t.Fatalf("groupBySyncObject failed to parse the dump")
+	}
+	expected := map[string][]GoID{
+		"internal/sync.(*Mutex).lockSlow(0xc0000a6000)": {6, 8},
+		"internal/sync.(*Mutex).lockSlow(0xc0000b8000)": {9},
+		"sync.runtime_Semacquire(0xc0000a6000)":         {7},
+		"chan receive at /src/main.go:23":               {10, 11},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected groups %v, got %v", expected, groups)
+	}
+}
+
+func TestGroupBySyncObject(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	var wg sync.WaitGroup
+	ids := make(chan GoID, 3)
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer wg.Done()
+			ids <- GetGoID()
+			mu.Lock()
+			defer mu.Unlock()
+		}()
+	}
+	blocked := make([]GoID, 0, 3)
+	for i := 0; i < 3; i++ {
+		id := <-ids
+		if err := WaitForState(id, "sync.Mutex.Lock", 5*time.Second); err != nil {
+			mu.Unlock()
+			t.Fatalf("goroutine did not block on the mutex: %v", err)
+		}
+		blocked = append(blocked, id)
+	}
+
+	groups, err := GroupBySyncObject()
+	mu.Unlock()
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("GroupBySyncObject failed: %v", err)
+	}
+
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i] < blocked[j] })
+	for _, group := range groups {
+		if reflect.DeepEqual(group, blocked) {
+			return
+		}
+	}
+	t.Errorf("expected goroutines %v in one group, got %v", blocked, groups)
+}
@@ -0,0 +1,43 @@
+// Command cgocallback is run by TestCgoCallback, to check goroutine ids in Go
+// code called back from C, both on the thread of the cgo call and on a thread
+// which the Go runtime did not create.
+package main
+
+/*
+#cgo LDFLAGS: -lpthread
+
+#include <pthread.h>
+
+extern void report(void);
+
+static void *reportThread(void *arg) {
+	report();
+	return NULL;
+}
+
+static int callBack(void) {
+	pthread_t thread;
+
+	report();
+	if (pthread_create(&thread, NULL, reportThread, NULL) != 0) {
+		return -1;
+	}
+	return pthread_join(thread, NULL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/observeinc/goid"
+)
+
+func main() {
+	fmt.Printf("%d\n", goid.GetGoID())
+	if C.callBack() != 0 {
+		fmt.Fprintln(os.Stderr, "failed to call back from a C thread")
+		os.Exit(1)
+	}
+}
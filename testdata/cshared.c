@@ -0,0 +1,23 @@
+#include <pthread.h>
+#include <stdio.h>
+
+#include "libcshared.h"
+
+static void *report(void *arg) {
+	Report();
+	fflush(stdout);
+	return NULL;
+}
+
+int main(void) {
+	pthread_t thread;
+
+	// From the thread which loaded the library, then from a thread which
+	// the Go runtime did not create
+	report(NULL);
+	if (pthread_create(&thread, NULL, report, NULL) != 0) {
+		return 1;
+	}
+	pthread_join(thread, NULL);
+	return 0;
+}
@@ -0,0 +1,26 @@
+// Command cshared is built with -buildmode=c-shared by TestCShared, to check
+// goroutine ids in Go code called from C threads.
+package main
+
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/observeinc/goid"
+)
+
+// Report prints, on a single line, whether the fast path is available, two
+// consecutive GetGoID results and the id parsed from the stack trace
+//
+//export Report
+func Report() {
+	buf := make([]byte, 64)
+	var stackID int64
+	fmt.Sscanf(strings.TrimPrefix(string(buf[:runtime.Stack(buf, false)]), "goroutine "), "%d", &stackID)
+	fmt.Printf("%v %d %d %d\n", goid.FastGetGoIDAvailable(), goid.GetGoID(), goid.GetGoID(), stackID)
+}
+
+func main() {}
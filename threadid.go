@@ -0,0 +1,282 @@
+package goid
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"unsafe"
+)
+
+const (
+	ptrSize = int(unsafe.Sizeof(uintptr(0)))
+
+	mSize         = 1024    // Number of bytes of the "m" scanned for fields
+	threadVoters  = 4       // Number of threads locked to detect the id offset
+	maxThreadID   = 1 << 20 // Bound on plausible M ids, which count threads
+	minMAddress   = 4096    // Words below this can't point to an "m"
+	idStableReads = 3       // Number of reads a candidate id must survive
+)
+
+var (
+	threadIDOnce sync.Once
+	gmOffset     = -1 // Offset of the "m" pointer in the "g"
+	mIDOffset    = -1 // Offset of the id in the "m"
+)
+
+// GetThreadID returns the id of the runtime "m", the OS thread the current
+// goroutine is running on. Unless the goroutine is locked with
+// runtime.LockOSThread, it may be moved to another thread right after the
+// call. Returns false if the id could not be located.
+//
+// The "m" pointer in the "g" and the id in the "m" are detected on the first
+// call, and validated against threads locked by runtime.LockOSThread. With
+// the goid_safe build tag, it always returns false.
+func GetThreadID() (int64, bool) {
+	if !fastPathEnabled {
+		return 0, false
+	}
+	threadIDOnce.Do(func() {
+		gmOffset, mIDOffset = getThreadIDOffsets()
+	})
+	if mIDOffset < 0 {
+		return 0, false
+	}
+	m := wordFromG(getg(), gmOffset)
+	if m == 0 {
+		return 0, false
+	}
+	return int64At(m, mIDOffset), true
+}
+
+// RunPinned runs fn with the current goroutine locked to its OS thread, see
+// runtime.LockOSThread, and passes it the goroutine id and the thread id, see
+// GetThreadID, which can't change until fn returns. The thread id is -1 if it
+// can't be determined. The thread is unlocked once fn returns or panics.
+func RunPinned(fn func(id GoID, mid int64)) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	mid, ok := GetThreadID()
+	if !ok {
+		mid = -1
+	}
+	fn(GetGoID(), mid)
+}
+
+// getThreadIDOffsets figures out the offset of the "m" pointer in the "g", and
+// of the id in the "m". Returns -1 for both if either can't be located.
+func getThreadIDOffsets() (mOffset, idOffset int) {
+	// Handle segmentation faults in case we run past the "g" or the "m"
+	oldPanicOnFault := debug.SetPanicOnFault(true)
+	defer func() {
+		if r := recover(); r != nil {
+			mOffset, idOffset = -1, -1
+		}
+	}()
+	defer debug.SetPanicOnFault(oldPanicOnFault)
+
+	self := getg()
+	if self == nil {
+		return -1, -1
+	}
+	candidates := findMOffsets(self)
+	for i := 0; i < checkCount && len(candidates) > 0; i++ {
+		candidates = checkMOffsets(candidates)
+	}
+	if len(candidates) == 0 {
+		return -1, -1
+	}
+	c := candidates[0]
+	if idOffset = findMIDOffset(c); idOffset < 0 {
+		return -1, -1
+	}
+	return c.m, idOffset
+}
+
+// mCandidate is a candidate offset of the "m" pointer in the "g", along with
+// the offset in the "m" which points back to the "g", that is "m.curg"
+type mCandidate struct {
+	m, curg int
+}
+
+// findMOffsets returns the offsets in the "g" which hold a pointer to a
+// structure pointing back to the "g", as the "m" does while it runs the "g"
+func findMOffsets(self *g) []mCandidate {
+	var candidates []mCandidate
+	for offset := 0; offset < gSize; offset += ptrSize {
+		if curg := findCurg(self, wordFromG(self, offset)); curg >= 0 {
+			candidates = append(candidates, mCandidate{m: offset, curg: curg})
+		}
+	}
+	return candidates
+}
+
+// findCurg returns the first offset in the structure at address m which
+// points to self, or -1
+func findCurg(self *g, m uintptr) int {
+	return findPointer(m, uintptr(unsafe.Pointer(self)), mSize)
+}
+
+// findPointer returns the first offset within size bytes of the structure at
+// address base which holds target, or -1. A fault means base is not a pointer,
+// and is recovered.
+func findPointer(base, target uintptr, size int) (offset int) {
+	if base < minMAddress {
+		return -1
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			offset = -1
+		}
+	}()
+	for offset = 0; offset < size; offset += ptrSize {
+		if wordAt(base, offset) == target {
+			return offset
+		}
+	}
+	return -1
+}
+
+// checkMOffsets blocks a goroutine on a channel and returns the candidates
+// whose "m" pointer is nil in its "g" while it is parked, and which still
+// point back to the "g" in a goroutine locked to another thread
+func checkMOffsets(candidates []mCandidate) []mCandidate {
+	gCh := make(chan *g)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gCh <- getg()
+		<-release
+	}()
+	blocked := <-gCh
+
+	lockedCh := make(chan []mCandidate)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		debug.SetPanicOnFault(true)
+		defer func() {
+			if r := recover(); r != nil {
+				lockedCh <- nil
+			}
+		}()
+		var confirmed []mCandidate
+		for _, c := range candidates {
+			if findCurg(getg(), wordFromG(getg(), c.m)) == c.curg {
+				confirmed = append(confirmed, c)
+			}
+		}
+		lockedCh <- confirmed
+	}()
+	candidates = <-lockedCh
+
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	// Give the goroutine a chance to park, as the runtime only clears the
+	// "m" pointer once the goroutine is off its thread
+	var confirmed []mCandidate
+	for try := 0; try < 1000 && len(confirmed) == 0; try++ {
+		runtime.Gosched()
+		for _, c := range candidates {
+			if wordFromG(blocked, c.m) == 0 {
+				confirmed = append(confirmed, c)
+			}
+		}
+	}
+	return confirmed
+}
+
+// findMIDOffset locks a few goroutines to their own threads at once, and
+// returns the first offset past "m.curg" which holds a plausible id that is
+// stable within each thread, and distinct across threads. Returns -1 if there
+// is none.
+func findMIDOffset(c mCandidate) int {
+	start := c.curg + ptrSize
+	count := (mSize - start) / ptrSize
+	if count <= 0 {
+		return -1
+	}
+
+	snapshots := make(chan []int64, threadVoters)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < threadVoters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			debug.SetPanicOnFault(true)
+			snapshots <- snapshotM(c, start, count)
+			// Keep the thread locked until all snapshots are taken, so
+			// that every voter runs on its own thread
+			<-release
+		}()
+	}
+	var votes [][]int64
+	for i := 0; i < threadVoters; i++ {
+		if snapshot := <-snapshots; snapshot != nil {
+			votes = append(votes, snapshot)
+		}
+	}
+	close(release)
+	wg.Wait()
+	if len(votes) < threadVoters {
+		return -1
+	}
+
+next:
+	for i := 0; i < count; i++ {
+		seen := make(map[int64]bool, len(votes))
+		for _, vote := range votes {
+			id := vote[i]
+			if id < 0 || id >= maxThreadID || seen[id] {
+				continue next
+			}
+			seen[id] = true
+		}
+		return start + i*ptrSize
+	}
+	return -1
+}
+
+// snapshotM reads count int64s from the "m" of the current goroutine, which
+// must be locked to its thread, starting at offset start. Values which change
+// across yields are replaced by -1, since an id never changes. Returns nil if
+// the "m" can't be read.
+func snapshotM(c mCandidate, start, count int) (snapshot []int64) {
+	defer func() {
+		if r := recover(); r != nil {
+			snapshot = nil
+		}
+	}()
+	read := func() []int64 {
+		m := wordFromG(getg(), c.m)
+		if findCurg(getg(), m) != c.curg {
+			return nil
+		}
+		values := make([]int64, count)
+		for i := range values {
+			values[i] = int64At(m, start+i*ptrSize)
+		}
+		return values
+	}
+
+	snapshot = read()
+	for i := 1; i < idStableReads && snapshot != nil; i++ {
+		runtime.Gosched()
+		values := read()
+		if values == nil {
+			return nil
+		}
+		for j := range snapshot {
+			if snapshot[j] != values[j] {
+				snapshot[j] = -1
+			}
+		}
+	}
+	return snapshot
+}
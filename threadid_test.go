@@ -0,0 +1,153 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestGetThreadID(t *testing.T) {
+	if getg() == nil {
+		t.Skip("getg not available")
+	}
+	id, ok := GetThreadID()
+	if !ok {
+		t.Fatalf("GetThreadID failed to locate the M id")
+	}
+	if id < 0 {
+		t.Errorf("expected a non-negative M id, got %d", id)
+	}
+
+	// Goroutines locked to their own threads at once have distinct ids, which
+	// stay the same however often they yield
+	const count = 4
+	ids := make(chan int64, count)
+	release := make(chan struct{})
+	for i := 0; i < count; i++ {
+		go func() {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			first, _ := GetThreadID()
+			for j := 0; j < 100; j++ {
+				runtime.Gosched()
+				if id, _ := GetThreadID(); id != first {
+					t.Errorf("M id of a locked goroutine changed from %d to %d", first, id)
+					break
+				}
+			}
+			ids <- first
+			<-release
+		}()
+	}
+	seen := make(map[int64]bool)
+	for i := 0; i < count; i++ {
+		id := <-ids
+		if seen[id] {
+			t.Errorf("M id %d shared by two locked goroutines", id)
+		}
+		seen[id] = true
+	}
+	close(release)
+}
+
+func TestRunPinned(t *testing.T) {
+	const count = 4
+	type identity struct {
+		id  GoID
+		mid int64
+	}
+	identities := make(chan identity, count)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RunPinned(func(id GoID, mid int64) {
+				if id != slowGid() {
+					t.Errorf("RunPinned passed id %d, expected %d", id, slowGid())
+				}
+				for j := 0; j < 100; j++ {
+					runtime.Gosched()
+					if now, ok := GetThreadID(); ok && now != mid {
+						t.Errorf("thread id changed from %d to %d while pinned", mid, now)
+						break
+					}
+				}
+				identities <- identity{id, mid}
+				// Stay pinned until all goroutines report, so that they
+				// are pinned to distinct threads at once
+				<-release
+			})
+		}()
+	}
+
+	ids := make(map[GoID]bool)
+	mids := make(map[int64]bool)
+	for i := 0; i < count; i++ {
+		got := <-identities
+		if ids[got.id] {
+			t.Errorf("goroutine id %d seen twice", got.id)
+		}
+		ids[got.id] = true
+		if getg() == nil {
+			if got.mid != -1 {
+				t.Errorf("expected thread id -1 without getg, got %d", got.mid)
+			}
+			continue
+		}
+		if got.mid < 0 || mids[got.mid] {
+			t.Errorf("expected distinct thread ids, got %d twice or negative", got.mid)
+		}
+		mids[got.mid] = true
+	}
+	close(release)
+	wg.Wait()
+
+	// The thread is unlocked even if fn panics
+	if _, ok := GetThreadID(); !ok {
+		return
+	}
+	if !lockedAfter(func() { runtime.LockOSThread() }) {
+		t.Fatalf("lockedAfter failed to tell a locked goroutine")
+	}
+	if lockedAfter(func() {}) {
+		t.Fatalf("lockedAfter reported an unlocked goroutine as locked")
+	}
+	if lockedAfter(func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to propagate, got %v", r)
+			}
+		}()
+		RunPinned(func(GoID, int64) {
+			panic("boom")
+		})
+	}) {
+		t.Errorf("goroutine still locked to its thread after fn panicked")
+	}
+}
+
+// lockedAfter runs fn in a new goroutine, and tells whether the goroutine is
+// locked to its thread afterwards. With a single P, a goroutine which parks
+// hands its thread over to the goroutine it woke up, unless it is locked to
+// it, so the goroutine it wakes runs on another thread.
+func lockedAfter(fn func()) bool {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	mids := make(chan int64)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+		mid, _ := GetThreadID()
+		mids <- mid
+		<-release
+		runtime.UnlockOSThread()
+	}()
+	mid := <-mids
+	now, _ := GetThreadID()
+	close(release)
+	<-done
+	return now != mid
+}
@@ -0,0 +1,24 @@
+package goid
+
+import (
+	"context"
+	"runtime/trace"
+	"strconv"
+)
+
+// TraceLog emits a runtime/trace log event of the given category, with the
+// current goroutine id as the message
+func TraceLog(ctx context.Context, category string) {
+	trace.Log(ctx, category, strconv.FormatInt(int64(GetGoID()), 10))
+}
+
+// StartRegionWithGoID starts a runtime/trace region named after regionType and
+// the current goroutine id, e.g. "handler goroutine 4711". As with
+// trace.StartRegion, the region must be ended on the same goroutine. While
+// tracing is off, the goroutine id is not looked up.
+func StartRegionWithGoID(ctx context.Context, regionType string) *trace.Region {
+	if !trace.IsEnabled() {
+		return trace.StartRegion(ctx, regionType)
+	}
+	return trace.StartRegion(ctx, regionType+" goroutine "+strconv.FormatInt(int64(GetGoID()), 10))
+}
@@ -0,0 +1,34 @@
+package goid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/trace"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	// Works, and does nothing, while tracing is off
+	TraceLog(context.Background(), "goid")
+	StartRegionWithGoID(context.Background(), "idle").End()
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("tracing not available: %v", err)
+	}
+	ctx, task := trace.NewTask(context.Background(), "test")
+	TraceLog(ctx, "goid-category")
+	region := StartRegionWithGoID(ctx, "test-region")
+	region.End()
+	task.End()
+	trace.Stop()
+
+	name := fmt.Sprintf("test-region goroutine %d", GetGoID())
+	if !bytes.Contains(buf.Bytes(), []byte(name)) {
+		t.Errorf("expected the trace to contain region %q", name)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("goid-category")) {
+		t.Errorf("expected the trace to contain the log category")
+	}
+}
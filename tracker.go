@@ -0,0 +1,66 @@
+package goid
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Tracker counts live goroutines by category, e.g. for capacity dashboards.
+// The zero value is ready to use.
+type Tracker struct {
+	mu      sync.RWMutex
+	counts  map[string]*int64 // Live goroutines by category
+	entered sync.Map          // GoID to category
+}
+
+// Enter counts the current goroutine in category, until it exits, see OnExit.
+// This doesn't rely on the goroutine cleaning up after itself, so goroutines
+// which panic or call runtime.Goexit are accounted for as well. As with
+// OnExit, the count drops some time after the exit. Entering another category
+// moves the goroutine there.
+func (t *Tracker) Enter(category string) {
+	id := GetGoID()
+	if prev, ok := t.entered.Load(id); ok {
+		t.add(prev.(string), -1)
+		t.entered.Store(id, category)
+	} else {
+		t.entered.Store(id, category)
+		onExit(id, func() {
+			if category, ok := t.entered.LoadAndDelete(id); ok {
+				t.add(category.(string), -1)
+			}
+		})
+	}
+	t.add(category, 1)
+}
+
+// add adds delta to the count of category
+func (t *Tracker) add(category string, delta int64) {
+	t.mu.RLock()
+	count, ok := t.counts[category]
+	t.mu.RUnlock()
+	if !ok {
+		t.mu.Lock()
+		if count, ok = t.counts[category]; !ok {
+			if t.counts == nil {
+				t.counts = make(map[string]*int64)
+			}
+			count = new(int64)
+			t.counts[category] = count
+		}
+		t.mu.Unlock()
+	}
+	atomic.AddInt64(count, delta)
+}
+
+// Counts returns the number of live goroutines in every category ever
+// entered, including categories which dropped back to zero
+func (t *Tracker) Counts() map[string]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	counts := make(map[string]int, len(t.counts))
+	for category, count := range t.counts {
+		counts[category] = int(atomic.LoadInt64(count))
+	}
+	return counts
+}
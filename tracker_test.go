@@ -0,0 +1,70 @@
+package goid
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	fastExitPolling(t)
+
+	var tracker Tracker
+	if counts := tracker.Counts(); len(counts) != 0 {
+		t.Fatalf("expected no counts, got %v", counts)
+	}
+
+	release := make(chan struct{})
+	var entered sync.WaitGroup
+	spawn := func(category string, n int, exit func()) {
+		for i := 0; i < n; i++ {
+			entered.Add(1)
+			go func() {
+				tracker.Enter(category)
+				entered.Done()
+				<-release
+				exit()
+			}()
+		}
+	}
+	spawn("http-handler", 3, func() {})
+	spawn("worker", 5, func() {})
+	// Goroutines which exit abnormally are accounted for too
+	spawn("crasher", 2, runtime.Goexit)
+	entered.Wait()
+
+	expected := map[string]int{"http-handler": 3, "worker": 5, "crasher": 2}
+	if counts := tracker.Counts(); len(counts) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, counts)
+	} else {
+		for category, n := range expected {
+			if counts[category] != n {
+				t.Errorf("expected %d goroutines in %q, got %d", n, category, counts[category])
+			}
+		}
+	}
+
+	// Moving to another category
+	tracker.Enter("worker")
+	tracker.Enter("main")
+	if counts := tracker.Counts(); counts["worker"] != 5 || counts["main"] != 1 {
+		t.Errorf("expected the test goroutine to move to \"main\", got %v", counts)
+	}
+
+	close(release)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		counts := tracker.Counts()
+		if counts["http-handler"] == 0 && counts["worker"] == 0 && counts["crasher"] == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the counts to drop to zero, got %v", counts)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if counts := tracker.Counts(); counts["main"] != 1 {
+		t.Errorf("expected the live test goroutine to remain counted, got %v", counts)
+	}
+}
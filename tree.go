@@ -0,0 +1,61 @@
+package goid
+
+// GoroutineNode is a goroutine in the tree built by BuildTree
+type GoroutineNode struct {
+	GoroutineInfo
+	Children []*GoroutineNode // Goroutines it created, in the order of infos
+}
+
+// BuildTree links goroutines to the goroutines they created, using the creator
+// ids recorded in GoroutineInfo.Parent, e.g. by Snapshot or ListGoroutines.
+// Returns the roots, in the order of infos: goroutines whose creator is unknown
+// or not in infos, such as the main goroutine or goroutines whose creator
+// exited. This shows the lineage of goroutines when looking for leaks.
+//
+// Every goroutine appears once in the tree. Creator ids can't form a cycle in
+// a single dump, but if they do, as with hand-made infos, the first goroutine
+// of the cycle becomes a root.
+func BuildTree(infos []GoroutineInfo) []*GoroutineNode {
+	nodes := make([]*GoroutineNode, len(infos))
+	byID := make(map[GoID]*GoroutineNode, len(infos))
+	for i := range infos {
+		nodes[i] = &GoroutineNode{GoroutineInfo: infos[i]}
+		if _, dup := byID[infos[i].ID]; !dup {
+			byID[infos[i].ID] = nodes[i]
+		}
+	}
+
+	var roots []*GoroutineNode
+	children := make(map[*GoroutineNode][]*GoroutineNode)
+	for _, node := range nodes {
+		parent, ok := byID[node.Parent]
+		if !ok || node.Parent == 0 || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		children[parent] = append(children[parent], node)
+	}
+
+	visited := make(map[*GoroutineNode]bool, len(nodes))
+	var attach func(node *GoroutineNode)
+	attach = func(node *GoroutineNode) {
+		visited[node] = true
+		for _, child := range children[node] {
+			if !visited[child] {
+				node.Children = append(node.Children, child)
+				attach(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		attach(root)
+	}
+	// Goroutines on a cycle are unreachable from the roots
+	for _, node := range nodes {
+		if !visited[node] {
+			roots = append(roots, node)
+			attach(node)
+		}
+	}
+	return roots
+}
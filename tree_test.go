@@ -0,0 +1,111 @@
+package goid
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// formatTree renders nodes as "1(2(4) 3) 5", for comparing tree structures
+func formatTree(nodes []*GoroutineNode) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = strconv.FormatInt(int64(node.ID), 10)
+		if len(node.Children) > 0 {
+			parts[i] += "(" + formatTree(node.Children) + ")"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		infos    []GoroutineInfo
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"lineage", []GoroutineInfo{
+			{ID: 1},
+			{ID: 2, Parent: 1},
+			{ID: 3, Parent: 1},
+			{ID: 4, Parent: 2},
+			{ID: 5, Parent: 4},
+		}, "1(2(4(5)) 3)"},
+		{"children listed before their creator", []GoroutineInfo{
+			{ID: 4, Parent: 2},
+			{ID: 3, Parent: 1},
+			{ID: 2, Parent: 1},
+			{ID: 1},
+		}, "1(3 2(4))"},
+		{"exited creators", []GoroutineInfo{
+			{ID: 1},
+			{ID: 7, Parent: 6},
+			{ID: 8, Parent: 7},
+			{ID: 9, Parent: 42},
+		}, "1 7(8) 9"},
+		{"self parent", []GoroutineInfo{{ID: 3, Parent: 3}}, "3"},
+		{"cycle", []GoroutineInfo{
+			{ID: 1},
+			{ID: 2, Parent: 3},
+			{ID: 3, Parent: 4},
+			{ID: 4, Parent: 2},
+			{ID: 5, Parent: 4},
+		}, "1 2(4(3 5))"},
+	}
+	for _, test := range tests {
+		roots := BuildTree(test.infos)
+		if tree := formatTree(roots); tree != test.expected {
+			t.Errorf("%s: BuildTree() = %q, expected %q", test.name, tree, test.expected)
+		}
+	}
+
+	// Nodes carry the info of their goroutine
+	roots := BuildTree([]GoroutineInfo{{ID: 1, State: "running", Function: "main.main"}})
+	if len(roots) != 1 || roots[0].State != "running" || roots[0].Function != "main.main" {
+		t.Errorf("BuildTree() lost the goroutine info: %+v", roots)
+	}
+}
+
+func TestBuildTreeFromSnapshot(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ids := make(chan GoID)
+	go func() {
+		ids <- GetGoID()
+		go func() {
+			ids <- GetGoID()
+			<-release
+		}()
+		<-release
+	}()
+	parent, child := <-ids, <-ids
+
+	infos, err := Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	var find func(nodes []*GoroutineNode, id GoID) *GoroutineNode
+	find = func(nodes []*GoroutineNode, id GoID) *GoroutineNode {
+		for _, node := range nodes {
+			if node.ID == id {
+				return node
+			}
+			if found := find(node.Children, id); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	roots := BuildTree(infos)
+	node := find(roots, parent)
+	if node == nil {
+		t.Fatalf("goroutine %d missing from the tree", parent)
+	}
+	if find(node.Children, child) == nil {
+		t.Errorf("goroutine %d missing from the children of its creator %d", child, parent)
+	}
+	if self := find(roots, GetGoID()); self == nil || find(self.Children, parent) == nil {
+		t.Errorf("goroutine %d missing from the children of the test goroutine", parent)
+	}
+}
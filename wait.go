@@ -0,0 +1,56 @@
+package goid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrGoroutineNotFound is returned by WaitForState when the goroutine
+	// does not exist
+	ErrGoroutineNotFound = errors.New("goid: goroutine not found")
+	// ErrStateTimeout is returned by WaitForState when the goroutine did not
+	// reach the state in time
+	ErrStateTimeout = errors.New("goid: timed out waiting for goroutine state")
+)
+
+const (
+	minStatePollInterval = time.Millisecond
+	maxStatePollInterval = 100 * time.Millisecond
+)
+
+// WaitForState polls the stack dump until the goroutine with the given id is
+// in a state starting with state, e.g. "chan receive", or until timeout
+// elapses. The poll interval backs off exponentially to limit the cost of the
+// dumps. This is meant to replace sleeps in tests which need a goroutine to be
+// blocked before proceeding.
+func WaitForState(id GoID, state string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	interval := minStatePollInterval
+	for {
+		current, alive, err := findGoroutine(id)
+		switch {
+		case err != nil:
+			return err
+		case !alive:
+			return fmt.Errorf("%w: goroutine %d", ErrGoroutineNotFound, id)
+		case strings.HasPrefix(current, state):
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w: goroutine %d is in state %q, not %q",
+				ErrStateTimeout, id, current, state)
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		if interval *= 2; interval > maxStatePollInterval {
+			interval = maxStatePollInterval
+		}
+	}
+}
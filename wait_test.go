@@ -0,0 +1,45 @@
+package goid
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForState(t *testing.T) {
+	ids := make(chan GoID)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ids <- GetGoID()
+		<-release
+	}()
+	id := <-ids
+
+	if err := WaitForState(id, "chan receive", 5*time.Second); err != nil {
+		t.Errorf("WaitForState failed: %v", err)
+	}
+
+	start := time.Now()
+	err := WaitForState(id, "select", 50*time.Millisecond)
+	if !errors.Is(err, ErrStateTimeout) {
+		t.Errorf("expected ErrStateTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected WaitForState to time out after 50ms, took %v", elapsed)
+	}
+
+	close(release)
+	<-done
+	for i := 0; ; i++ {
+		err := WaitForState(id, "chan receive", 0)
+		if errors.Is(err, ErrGoroutineNotFound) {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("expected ErrGoroutineNotFound for an exited goroutine, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build wasm
+
+package goid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWasm(t *testing.T) {
+	if initGoID <= 0 {
+		t.Errorf("slowGid() = %d on the main goroutine, expected a positive id", initGoID)
+	}
+	if FastGetGoIDAvailable() {
+		t.Errorf("FastGetGoIDAvailable() = true on wasm, which has no getg")
+	}
+	if stack := string(currentStack()); !strings.HasPrefix(stack, goroutinePrefix) {
+		t.Errorf("unexpected stack header in %q", stack)
+	}
+	testGid(t, GetGoID)
+}